@@ -0,0 +1,69 @@
+// Package accesslist generates EIP-2930 access lists for calls, as done by eth_createAccessList,
+// on top of any of the StateDB implementations in this module.
+package accesslist
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers/logger"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// StateDB is a vm.StateDB which can be copied, as implemented by both the direct_by_leaf
+// and trie_by_cid StateDBs.
+type StateDB[S any] interface {
+	vm.StateDB
+
+	// Copy creates a deep, independent copy of the state.
+	Copy() S
+	// Error returns the memorized database failure occurred earlier.
+	Error() error
+}
+
+// Create runs the message on copies of base, expanding the access list with everything the
+// execution touches until it no longer changes. Any access list in msg is used as the starting
+// point. As in geth, the sender, the recipient (or created contract) and the active precompiles
+// are left out, unless their storage is accessed.
+//
+// It returns the resulting access list, the gas used by the message when sent with it, and vmErr,
+// the error of the final execution if it failed. A non-nil err is returned if the message couldn't
+// be applied at all.
+func Create[S StateDB[S]](base S, msg core.Message, blockCtx vm.BlockContext, chainConfig *params.ChainConfig) (acl types.AccessList, gasUsed uint64, vmErr error, err error) {
+	var to common.Address
+	if msg.To != nil {
+		to = *msg.To
+	} else {
+		to = crypto.CreateAddress(msg.From, base.GetNonce(msg.From))
+	}
+	// Retrieve the precompiles since they don't need to be added to the access list
+	rules := chainConfig.Rules(blockCtx.BlockNumber, blockCtx.Random != nil, blockCtx.Time)
+	precompiles := vm.ActivePrecompiles(rules)
+
+	prevTracer := logger.NewAccessListTracer(msg.AccessList, msg.From, to, precompiles)
+	for {
+		// Retrieve the current access list to expand, and apply it on a fresh copy
+		accessList := prevTracer.AccessList()
+		statedb := base.Copy()
+		msg.AccessList = accessList
+
+		tracer := logger.NewAccessListTracer(accessList, msg.From, to, precompiles)
+		config := vm.Config{Tracer: tracer, NoBaseFee: true}
+		evm := vm.NewEVM(blockCtx, core.NewEVMTxContext(&msg), statedb, chainConfig, config)
+		res, err := core.ApplyMessage(evm, &msg, new(core.GasPool).AddGas(msg.GasLimit))
+		if err == nil {
+			err = statedb.Error()
+		}
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("failed to apply message: %w", err)
+		}
+		if tracer.Equal(prevTracer) {
+			return accessList, res.UsedGas, res.Err, nil
+		}
+		prevTracer = tracer
+	}
+}
@@ -0,0 +1,117 @@
+package accesslist_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+
+	"github.com/cerc-io/ipld-eth-statedb/accesslist"
+	leaf "github.com/cerc-io/ipld-eth-statedb/direct_by_leaf"
+	"github.com/cerc-io/ipld-eth-statedb/trie_by_cid/state"
+)
+
+var (
+	testSender   = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	testContract = common.HexToAddress("0x1000000000000000000000000000000000000002")
+	testSlot     = common.BigToHash(big.NewInt(1))
+	// PUSH1 0x01 SLOAD STOP
+	testCode = []byte{byte(vm.PUSH1), 0x01, byte(vm.SLOAD), byte(vm.STOP)}
+)
+
+// memoryStateDatabase is a direct_by_leaf StateDatabase serving the sender and contract
+type memoryStateDatabase struct{}
+
+func (memoryStateDatabase) ContractCode(codeHash common.Hash) ([]byte, error) {
+	if codeHash != crypto.Keccak256Hash(testCode) {
+		return nil, errors.New("not found")
+	}
+	return testCode, nil
+}
+
+func (db memoryStateDatabase) ContractCodeSize(codeHash common.Hash) (int, error) {
+	code, err := db.ContractCode(codeHash)
+	return len(code), err
+}
+
+func (memoryStateDatabase) StateAccount(addressHash, _ common.Hash) (*types.StateAccount, error) {
+	switch addressHash {
+	case crypto.Keccak256Hash(testSender[:]):
+		return &types.StateAccount{
+			Balance:  big.NewInt(params.Ether),
+			Root:     types.EmptyRootHash,
+			CodeHash: types.EmptyCodeHash.Bytes(),
+		}, nil
+	case crypto.Keccak256Hash(testContract[:]):
+		return &types.StateAccount{
+			Balance:  new(big.Int),
+			Root:     types.EmptyRootHash,
+			CodeHash: crypto.Keccak256(testCode),
+		}, nil
+	}
+	return nil, nil
+}
+
+func (memoryStateDatabase) StorageValue(_, _, _ common.Hash) ([]byte, error) {
+	return nil, nil
+}
+
+func TestCreate(t *testing.T) {
+	sdb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	sdb.SetBalance(testSender, big.NewInt(params.Ether))
+	sdb.SetCode(testContract, testCode)
+	sdb.Finalise(true)
+
+	testCreate(t, sdb)
+}
+
+func TestCreateDirectByLeaf(t *testing.T) {
+	sdb, err := leaf.New(common.Hash{}, memoryStateDatabase{})
+	require.NoError(t, err)
+
+	testCreate(t, sdb)
+}
+
+func testCreate[S accesslist.StateDB[S]](t *testing.T, sdb S) {
+	blockCtx := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		GetHash:     func(uint64) common.Hash { return common.Hash{} },
+		BlockNumber: big.NewInt(1),
+		GasLimit:    30_000_000,
+		Difficulty:  big.NewInt(0),
+		BaseFee:     big.NewInt(0),
+	}
+	msg := core.Message{
+		From:              testSender,
+		To:                &testContract,
+		Value:             big.NewInt(0),
+		GasLimit:          100_000,
+		GasPrice:          big.NewInt(0),
+		GasFeeCap:         big.NewInt(0),
+		GasTipCap:         big.NewInt(0),
+		SkipAccountChecks: true,
+	}
+	acl, gasUsed, vmErr, err := accesslist.Create(sdb, msg, blockCtx, params.TestChainConfig)
+	require.NoError(t, err)
+	require.NoError(t, vmErr)
+
+	// the recipient is listed, since its storage is accessed
+	expected := types.AccessList{{Address: testContract, StorageKeys: []common.Hash{testSlot}}}
+	require.Equal(t, expected, acl)
+	// intrinsic gas including the list, PUSH1, and a warm SLOAD
+	require.Equal(t, params.TxGas+params.TxAccessListAddressGas+params.TxAccessListStorageKeyGas+3+params.WarmStorageReadCostEIP2929, gasUsed)
+
+	// the base state is left untouched
+	require.Equal(t, uint64(0), sdb.GetNonce(testSender))
+}
@@ -0,0 +1,83 @@
+package state_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cerc-io/plugeth-statediff/indexer/database/sql/postgres"
+	"github.com/stretchr/testify/require"
+
+	state "github.com/cerc-io/ipld-eth-statedb/direct_by_leaf"
+	"github.com/cerc-io/ipld-eth-statedb/sql"
+)
+
+func BenchmarkPGXStateDatabase(b *testing.B) {
+	testConfig, err := postgres.TestConfig.WithEnv()
+	require.NoError(b, err)
+	pool, err := postgres.ConnectPGX(testCtx, testConfig)
+	require.NoError(b, err)
+	b.Cleanup(func() {
+		for _, stm := range teardownStatements {
+			_, err := pool.Exec(testCtx, stm)
+			require.NoErrorf(b, err, "Exec(`%s`)", stm)
+		}
+		pool.Close()
+	})
+	benchmarkStateDatabase(b, func() sql.Database {
+		return sql.NewPGXDriverFromPool(context.Background(), pool)
+	})
+}
+
+func BenchmarkSQLXStateDatabase(b *testing.B) {
+	testConfig, err := postgres.TestConfig.WithEnv()
+	require.NoError(b, err)
+	pool, err := postgres.ConnectSQLX(testCtx, testConfig)
+	require.NoError(b, err)
+	b.Cleanup(func() {
+		for _, stm := range teardownStatements {
+			_, err := pool.Exec(stm)
+			require.NoErrorf(b, err, "Exec(`%s`)", stm)
+		}
+		pool.Close()
+	})
+	benchmarkStateDatabase(b, func() sql.Database {
+		return sql.NewSQLXDriverFromPool(context.Background(), pool)
+	})
+}
+
+// benchmarkStateDatabase measures concurrent account and storage reads, as made by eth_call,
+// with and without explicitly prepared statements. The baseline is the driver as configured by
+// default, so for pgx it includes the statements prepared by its statement cache.
+func benchmarkStateDatabase(b *testing.B, newDriver func() sql.Database) {
+	insertSuiteData(b, newDriver())
+
+	run := func(b *testing.B, db state.StateDatabase) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := db.StateAccount(AccountLeafKey, BlockHash3); err != nil {
+					b.Error(err)
+					return
+				}
+				if _, err := db.StorageValue(AccountLeafKey, StorageLeafKey, BlockHash3); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	}
+	b.Run("baseline", func(b *testing.B) {
+		run(b, state.NewStateDatabase(newDriver()))
+	})
+	b.Run("prepared", func(b *testing.B) {
+		db, err := state.NewStateDatabaseWithConfig(testCtx, newDriver(), state.StatementConfig{})
+		require.NoError(b, err)
+		run(b, db)
+	})
+	b.Run("prepared inline", func(b *testing.B) {
+		db, err := state.NewStateDatabaseWithConfig(testCtx, newDriver(), state.StatementConfig{InlineStorage: true})
+		require.NoError(b, err)
+		run(b, db)
+	})
+}
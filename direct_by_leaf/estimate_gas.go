@@ -0,0 +1,123 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// EstimateGas binary searches for the lowest gas limit at which msg executes without failure
+// on top of the base state. The upper bound is gasCap, lowered to msg.GasLimit if that is set,
+// and, as in geth, to the gas the sender can fund at msg.GasFeeCap after transferring msg.Value.
+//
+// Rather than reading the state afresh for every probe, a single warm-up execution is run at
+// the upper bound directly on base and then reverted, which leaves everything it touched loaded
+// in base. Each probe of the search then runs on a copy of this pre-loaded state, so accounts,
+// slots and code are fetched from the database only once.
+//
+// If the message fails even at the upper bound, a zero estimate is returned along with the
+// failed execution result, whose Err holds the reason (e.g. vm.ErrExecutionReverted, with
+// the revert data in ReturnData). A non-nil error means no estimate could be made, e.g. because
+// of a database failure or a message which is invalid regardless of gas.
+func EstimateGas(base *StateDB, msg core.Message, blockCtx vm.BlockContext, chainConfig *params.ChainConfig, gasCap uint64) (uint64, *core.ExecutionResult, error) {
+	hi := gasCap
+	if msg.GasLimit >= params.TxGas && msg.GasLimit < hi {
+		hi = msg.GasLimit
+	}
+	if hi < params.TxGas {
+		return 0, nil, fmt.Errorf("gas cap %d is below the intrinsic minimum %d", hi, params.TxGas)
+	}
+	// Recap the upper bound with the sender's available balance, so that an underfunded
+	// sender fails on its funds rather than searching up to the cap.
+	if msg.GasFeeCap != nil && msg.GasFeeCap.BitLen() != 0 {
+		available := new(big.Int).Set(base.GetBalance(msg.From))
+		if err := base.Error(); err != nil {
+			return 0, nil, err
+		}
+		if msg.Value != nil {
+			if msg.Value.Cmp(available) >= 0 {
+				return 0, nil, core.ErrInsufficientFundsForTransfer
+			}
+			available.Sub(available, msg.Value)
+		}
+		allowance := new(big.Int).Div(available, msg.GasFeeCap)
+		// If the allowance is larger than maximum uint64, skip checking
+		if allowance.IsUint64() && hi > allowance.Uint64() {
+			hi = allowance.Uint64()
+		}
+		if hi < params.TxGas {
+			return 0, nil, fmt.Errorf("%w: address %v can fund %d gas, below the intrinsic minimum %d",
+				core.ErrInsufficientFunds, msg.From, hi, params.TxGas)
+		}
+	}
+
+	// Warm up the base state. Reverting drops the changes made by the execution but keeps the
+	// loaded objects live, and these are carried over by Copy.
+	revid := base.Snapshot()
+	result, err := applyMessage(base, msg, hi, blockCtx, chainConfig)
+	base.RevertToSnapshot(revid)
+	if err == nil {
+		err = base.Error()
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if result.Failed() {
+		return 0, result, nil
+	}
+
+	// Execution with less gas than was used at the cap can't succeed, which gives us a
+	// tighter lower bound than the intrinsic gas.
+	lo := params.TxGas - 1
+	if result.UsedGas > lo+1 {
+		lo = result.UsedGas - 1
+	}
+	for lo+1 < hi {
+		mid := lo + (hi-lo)/2
+		statedb := copyLoaded(base)
+		result, err := applyMessage(statedb, msg, mid, blockCtx, chainConfig)
+		if err == nil {
+			err = statedb.Error()
+		}
+		if err != nil {
+			// Too little gas to even cover the intrinsic cost is just a failed probe
+			if errors.Is(err, core.ErrIntrinsicGas) {
+				lo = mid
+				continue
+			}
+			return 0, nil, err
+		}
+		if result.Failed() {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi, nil, nil
+}
+
+// copyLoaded is like Copy, but also carries over the clean state objects. Unlike a trie backed
+// state, there is no node cache behind them, so dropping them would mean going back to the
+// database for every account and slot already read.
+func copyLoaded(s *StateDB) *StateDB {
+	state := s.Copy()
+	for addr, object := range s.stateObjects {
+		if _, exist := state.stateObjects[addr]; !exist {
+			state.stateObjects[addr] = object.deepCopy(state)
+		}
+	}
+	return state
+}
+
+// applyMessage executes msg against statedb with the given gas limit, with the same relaxed
+// fee rules as eth_call.
+func applyMessage(statedb *StateDB, msg core.Message, gas uint64, blockCtx vm.BlockContext, chainConfig *params.ChainConfig) (*core.ExecutionResult, error) {
+	msg.GasLimit = gas
+	evm := vm.NewEVM(blockCtx, core.NewEVMTxContext(&msg), statedb, chainConfig, vm.Config{NoBaseFee: true})
+	return core.ApplyMessage(evm, &msg, new(core.GasPool).AddGas(math.MaxUint64))
+}
@@ -0,0 +1,150 @@
+package state_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+
+	state "github.com/cerc-io/ipld-eth-statedb/direct_by_leaf"
+)
+
+// memoryStateDatabase is an in-memory StateDatabase which counts the account reads reaching it
+type memoryStateDatabase struct {
+	accounts     map[common.Hash]types.StateAccount
+	accountReads map[common.Hash]int
+}
+
+func newMemoryStateDatabase() *memoryStateDatabase {
+	return &memoryStateDatabase{
+		accounts:     make(map[common.Hash]types.StateAccount),
+		accountReads: make(map[common.Hash]int),
+	}
+}
+
+func (db *memoryStateDatabase) ContractCode(common.Hash) ([]byte, error) {
+	return nil, errors.New("not found")
+}
+
+func (db *memoryStateDatabase) ContractCodeSize(common.Hash) (int, error) {
+	return 0, errors.New("not found")
+}
+
+func (db *memoryStateDatabase) StateAccount(addressHash, _ common.Hash) (*types.StateAccount, error) {
+	db.accountReads[addressHash]++
+	acct, ok := db.accounts[addressHash]
+	if !ok {
+		return nil, nil
+	}
+	acct.Balance = new(big.Int).Set(acct.Balance)
+	return &acct, nil
+}
+
+func (db *memoryStateDatabase) StorageValue(_, _, _ common.Hash) ([]byte, error) {
+	return nil, nil
+}
+
+func TestEstimateGas(t *testing.T) {
+	var (
+		sender    = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		recipient = common.HexToAddress("0x1000000000000000000000000000000000000002")
+	)
+	db := newMemoryStateDatabase()
+	db.accounts[crypto.Keccak256Hash(sender[:])] = types.StateAccount{Balance: big.NewInt(params.Ether)}
+	db.accounts[crypto.Keccak256Hash(recipient[:])] = types.StateAccount{Balance: big.NewInt(1)}
+
+	sdb, err := state.New(BlockHash, db)
+	require.NoError(t, err)
+
+	blockCtx := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		GetHash:     func(uint64) common.Hash { return common.Hash{} },
+		BlockNumber: BlockNumber,
+		GasLimit:    30_000_000,
+		Difficulty:  big.NewInt(0),
+		BaseFee:     big.NewInt(0),
+	}
+	msg := core.Message{
+		From:              sender,
+		To:                &recipient,
+		Value:             big.NewInt(params.GWei),
+		GasPrice:          big.NewInt(0),
+		GasFeeCap:         big.NewInt(0),
+		GasTipCap:         big.NewInt(0),
+		SkipAccountChecks: true,
+	}
+
+	gas, failure, err := state.EstimateGas(sdb, msg, blockCtx, params.TestChainConfig, blockCtx.GasLimit)
+	require.NoError(t, err)
+	require.Nil(t, failure)
+	require.Equal(t, params.TxGas, gas)
+
+	// the base state must be left untouched by the warm-up
+	require.Equal(t, big.NewInt(params.Ether), sdb.GetBalance(sender))
+	require.Equal(t, big.NewInt(1), sdb.GetBalance(recipient))
+
+	// every probe should have been served from the pre-loaded state
+	require.Equal(t, 1, db.accountReads[crypto.Keccak256Hash(sender[:])])
+	require.Equal(t, 1, db.accountReads[crypto.Keccak256Hash(recipient[:])])
+
+	// a value transfer the sender can't afford fails at any gas limit
+	msg.Value = big.NewInt(2 * params.Ether)
+	_, _, err = state.EstimateGas(sdb, msg, blockCtx, params.TestChainConfig, blockCtx.GasLimit)
+	require.ErrorIs(t, err, core.ErrInsufficientFunds)
+}
+
+func TestEstimateGasBalanceCap(t *testing.T) {
+	var (
+		sender    = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		recipient = common.HexToAddress("0x1000000000000000000000000000000000000002")
+	)
+	// the sender can fund 50000 gas at 1 gwei
+	db := newMemoryStateDatabase()
+	db.accounts[crypto.Keccak256Hash(sender[:])] = types.StateAccount{Balance: big.NewInt(50_000 * params.GWei)}
+
+	sdb, err := state.New(BlockHash, db)
+	require.NoError(t, err)
+
+	blockCtx := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		GetHash:     func(uint64) common.Hash { return common.Hash{} },
+		BlockNumber: BlockNumber,
+		GasLimit:    30_000_000,
+		Difficulty:  big.NewInt(0),
+		BaseFee:     big.NewInt(0),
+	}
+	msg := core.Message{
+		From:              sender,
+		To:                &recipient,
+		Value:             big.NewInt(0),
+		GasPrice:          big.NewInt(params.GWei),
+		GasFeeCap:         big.NewInt(params.GWei),
+		GasTipCap:         big.NewInt(0),
+		SkipAccountChecks: true,
+	}
+
+	// the search is bounded by the balance rather than the block gas limit
+	gas, failure, err := state.EstimateGas(sdb, msg, blockCtx, params.TestChainConfig, blockCtx.GasLimit)
+	require.NoError(t, err)
+	require.Nil(t, failure)
+	require.Equal(t, params.TxGas, gas)
+
+	// after the transfer, the balance can't even fund the intrinsic gas
+	msg.Value = big.NewInt(40_000 * params.GWei)
+	_, _, err = state.EstimateGas(sdb, msg, blockCtx, params.TestChainConfig, blockCtx.GasLimit)
+	require.ErrorIs(t, err, core.ErrInsufficientFunds)
+
+	msg.Value = big.NewInt(50_000 * params.GWei)
+	_, _, err = state.EstimateGas(sdb, msg, blockCtx, params.TestChainConfig, blockCtx.GasLimit)
+	require.ErrorIs(t, err, core.ErrInsufficientFundsForTransfer)
+}
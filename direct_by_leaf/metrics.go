@@ -0,0 +1,20 @@
+package state
+
+import "github.com/ethereum/go-ethereum/metrics"
+
+var (
+	accountQueryTimer = metrics.NewRegisteredTimer("direct/query/account", nil)
+	storageQueryTimer = metrics.NewRegisteredTimer("direct/query/storage", nil)
+	codeQueryTimer    = metrics.NewRegisteredTimer("direct/query/code", nil)
+
+	accountNotFoundMeter = metrics.NewRegisteredMeter("direct/account/notfound", nil)
+	accountRemovedMeter  = metrics.NewRegisteredMeter("direct/account/removed", nil)
+	storageNotFoundMeter = metrics.NewRegisteredMeter("direct/storage/notfound", nil)
+	storageRemovedMeter  = metrics.NewRegisteredMeter("direct/storage/removed", nil)
+	codeNotFoundMeter    = metrics.NewRegisteredMeter("direct/code/notfound", nil)
+
+	codeCacheHitMeter      = metrics.NewRegisteredMeter("direct/code/cache/hit", nil)
+	codeCacheMissMeter     = metrics.NewRegisteredMeter("direct/code/cache/miss", nil)
+	codeSizeCacheHitMeter  = metrics.NewRegisteredMeter("direct/codesize/cache/hit", nil)
+	codeSizeCacheMissMeter = metrics.NewRegisteredMeter("direct/codesize/cache/miss", nil)
+)
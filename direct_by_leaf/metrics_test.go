@@ -0,0 +1,101 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cerc-io/ipld-eth-statedb/sql"
+)
+
+// enableMetrics replaces the metrics of the package with enabled ones for the test
+func enableMetrics(t *testing.T) {
+	enabled := metrics.Enabled
+	metrics.Enabled = true
+	t.Cleanup(func() { metrics.Enabled = enabled })
+
+	for _, m := range []*metrics.Meter{
+		&accountNotFoundMeter, &accountRemovedMeter, &storageNotFoundMeter, &storageRemovedMeter,
+		&codeNotFoundMeter, &codeCacheHitMeter, &codeCacheMissMeter, &codeSizeCacheHitMeter,
+		&codeSizeCacheMissMeter,
+	} {
+		m, prev := m, *m
+		*m = metrics.NewMeter()
+		t.Cleanup(func() { (*m).Stop(); *m = prev })
+	}
+	for _, tm := range []*metrics.Timer{&accountQueryTimer, &storageQueryTimer, &codeQueryTimer} {
+		tm, prev := tm, *tm
+		*tm = metrics.NewTimer()
+		t.Cleanup(func() { (*tm).Stop(); *tm = prev })
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	enableMetrics(t)
+
+	code := []byte{0x60, 0x00}
+	codeHash := crypto.Keccak256Hash(code)
+	driver := rowDriver{
+		DefaultStatements.ContractCode: {vals: []interface{}{code}},
+		DefaultStatements.StateAccount: {err: pgx.ErrNoRows},
+		DefaultStatements.StorageSlot:  {vals: []interface{}{[]byte{}, true, false}},
+	}
+	db := NewStateDatabase(driver)
+
+	for i := 0; i < 2; i++ {
+		_, err := db.ContractCode(codeHash)
+		require.NoError(t, err)
+	}
+	size, err := db.ContractCodeSize(codeHash)
+	require.NoError(t, err)
+	require.Equal(t, len(code), size)
+
+	_, err = db.StateAccount(codeHash, codeHash)
+	require.True(t, sql.IsNoRows(err))
+	value, err := db.StorageValue(codeHash, codeHash, codeHash)
+	require.NoError(t, err)
+	require.Nil(t, value)
+
+	require.Equal(t, int64(1), codeCacheHitMeter.Count())
+	require.Equal(t, int64(1), codeCacheMissMeter.Count())
+	require.Equal(t, int64(1), codeSizeCacheHitMeter.Count())
+	require.Equal(t, int64(1), accountNotFoundMeter.Count())
+	require.Equal(t, int64(1), storageRemovedMeter.Count())
+
+	// unknown code misses the size cache, without reading through the code cache meters
+	driver[DefaultStatements.ContractCode] = fakeRow{err: pgx.ErrNoRows}
+	driver[DefaultStatements.StateAccount] = fakeRow{vals: []interface{}{"0", uint64(0), "", "", true}}
+	driver[DefaultStatements.StorageSlot] = fakeRow{err: pgx.ErrNoRows}
+	_, err = db.ContractCodeSize(crypto.Keccak256Hash(nil))
+	require.True(t, sql.IsNoRows(err))
+	account, err := db.StateAccount(codeHash, codeHash)
+	require.NoError(t, err)
+	require.Nil(t, account)
+	_, err = db.StorageValue(codeHash, codeHash, codeHash)
+	require.True(t, sql.IsNoRows(err))
+
+	require.Equal(t, int64(1), codeSizeCacheMissMeter.Count())
+	require.Equal(t, int64(1), codeCacheMissMeter.Count())
+	require.Equal(t, int64(1), codeNotFoundMeter.Count())
+	require.Equal(t, int64(1), accountRemovedMeter.Count())
+	require.Equal(t, int64(1), storageNotFoundMeter.Count())
+
+	require.Equal(t, int64(2), codeQueryTimer.Count())
+	require.Equal(t, int64(2), accountQueryTimer.Count())
+	require.Equal(t, int64(2), storageQueryTimer.Count())
+
+	// code cached without its size is sized from the code cache, marking only a size miss
+	other := []byte{0x60, 0x01, 0x00}
+	otherHash := crypto.Keccak256Hash(other)
+	db.codeCache.Set(otherHash.Bytes(), other)
+	size, err = db.ContractCodeSize(otherHash)
+	require.NoError(t, err)
+	require.Equal(t, len(other), size)
+	require.Equal(t, int64(2), codeSizeCacheMissMeter.Count())
+	require.Equal(t, int64(1), codeCacheHitMeter.Count())
+	require.Equal(t, int64(1), codeCacheMissMeter.Count())
+	require.Equal(t, int64(2), codeQueryTimer.Count())
+}
@@ -0,0 +1,13 @@
+package state
+
+import "github.com/cerc-io/ipld-eth-statedb/internal/recorder"
+
+// AccessRecord holds all the state accessed through a StateDB while recording was enabled,
+// along with the values loaded from the database, i.e. the pre-state of the execution.
+type AccessRecord = recorder.AccessRecord
+
+// AccountRecord describes the accesses to a single account
+type AccountRecord = recorder.AccountRecord
+
+// SlotRecord describes the accesses to a single storage slot
+type SlotRecord = recorder.SlotRecord
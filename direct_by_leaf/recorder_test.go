@@ -0,0 +1,94 @@
+package state
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cerc-io/ipld-eth-statedb/sql"
+)
+
+// rowDriver is a sql.Driver answering each statement with a fixed row
+type rowDriver map[string]fakeRow
+
+type fakeRow struct {
+	vals []interface{}
+	err  error
+}
+
+func (d rowDriver) QueryRow(ctx context.Context, sql string, args ...interface{}) sql.ScannableRow {
+	return d[sql]
+}
+
+func (d rowDriver) Exec(ctx context.Context, sql string, args ...interface{}) (sql.Result, error) {
+	panic("unexpected Exec")
+}
+
+func (r fakeRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	for i, val := range r.vals {
+		reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(val))
+	}
+	return nil
+}
+
+func TestRecorder(t *testing.T) {
+	var (
+		read    = common.HexToAddress("0xaaaa")
+		written = common.HexToAddress("0xbbbb")
+		key     = common.Hash{0x01}
+		code    = []byte{0x60, 0x00}
+	)
+	// every account has the same balance, code and storage
+	driver := rowDriver{
+		GetContractCodePgStr: {vals: []interface{}{code}},
+		GetStateAccount: {vals: []interface{}{
+			"5", uint64(1), crypto.Keccak256Hash(code).Hex(), types.EmptyRootHash.Hex(), false,
+		}},
+		GetStorageSlot: {vals: []interface{}{[]byte{0x02}, false, false}},
+	}
+	state, err := New(common.Hash{}, NewStateDatabase(driver))
+	require.NoError(t, err)
+	require.Nil(t, state.Recording())
+	state.StartRecorder()
+
+	state.GetBalance(read)
+	state.GetCode(read)
+	state.SetBalance(written, big.NewInt(1))
+	state.SetState(written, key, common.Hash{0x03})
+	require.NoError(t, state.Error())
+	cpy := state.Copy()
+
+	rec := state.Recording()
+	require.Len(t, rec.Accounts, 2)
+	acct := rec.Accounts[read]
+	require.NotNil(t, acct)
+	require.NotNil(t, acct.Pre)
+	require.Equal(t, big.NewInt(5), acct.Pre.Balance)
+	require.False(t, acct.Written)
+	require.True(t, acct.CodeRead)
+
+	acct = rec.Accounts[written]
+	require.NotNil(t, acct)
+	require.NotNil(t, acct.Pre)
+	require.Equal(t, uint64(1), acct.Pre.Nonce)
+	require.True(t, acct.Written)
+	require.False(t, acct.CodeRead)
+	slot := acct.Storage[key]
+	require.NotNil(t, slot)
+	require.Equal(t, common.BytesToHash([]byte{0x02}), slot.Pre)
+	require.True(t, slot.Written)
+
+	// the copy records independently of the original
+	cpy.GetBalance(common.HexToAddress("0xcccc"))
+	require.Len(t, state.Recording().Accounts, 2)
+	require.Len(t, cpy.Recording().Accounts, 3)
+}
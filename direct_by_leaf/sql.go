@@ -1,22 +1,127 @@
 package state
 
+import (
+	"strings"
+)
+
 const (
-	GetContractCodePgStr = `SELECT data FROM ipld.blocks WHERE key = $1`
-	GetStateAccount      = `SELECT balance, nonce, code_hash, storage_root, removed FROM eth.state_cids
-						INNER JOIN eth.header_cids ON (
+	// default schemas of the ipld-eth-db tables
+	defaultEthSchema  = "eth"
+	defaultIPLDSchema = "ipld"
+
+	contractCodeTemplate = `SELECT data FROM {ipld}.blocks WHERE key = $1`
+	stateAccountTemplate = `SELECT balance, nonce, code_hash, storage_root, removed FROM {eth}.state_cids
+						INNER JOIN {eth}.header_cids ON (
 							state_cids.header_id = header_cids.block_hash
 							AND state_cids.block_number = header_cids.block_number
 						)
 						WHERE state_leaf_key = $1
 						AND header_cids.block_number <= (SELECT block_number
-															FROM eth.header_cids
+															FROM {eth}.header_cids
 															WHERE block_hash = $2)
 						AND header_cids.canonical
 						ORDER BY header_cids.block_number DESC
 						LIMIT 1`
-	GetStorageSlot = `SELECT val, removed, state_leaf_removed FROM get_storage_at_by_hash($1, $2, $3)`
+	storageSlotTemplate = `SELECT val, removed, state_leaf_removed FROM {fn}get_storage_at_by_hash($1, $2, $3)`
+
+	// inlineStorageSlotTemplate is equivalent to get_storage_at_by_hash, but can be planned
+	// with its parameters, and doesn't depend on the function being installed
+	inlineStorageSlotTemplate = `WITH target AS (SELECT block_number FROM {eth}.header_cids WHERE block_hash = $3 LIMIT 1)
+						SELECT storage_cids.val, storage_cids.removed,
+							COALESCE((SELECT state_cids.removed FROM {eth}.state_cids
+								INNER JOIN {eth}.header_cids ON (
+									state_cids.header_id = header_cids.block_hash
+									AND state_cids.block_number = header_cids.block_number
+								)
+								WHERE state_cids.state_leaf_key = $1
+								AND header_cids.block_number <= (SELECT block_number FROM target)
+								AND header_cids.canonical
+								ORDER BY header_cids.block_number DESC
+								LIMIT 1), false) AS state_leaf_removed
+						FROM {eth}.storage_cids
+						INNER JOIN {eth}.header_cids ON (
+							storage_cids.header_id = header_cids.block_hash
+							AND storage_cids.block_number = header_cids.block_number
+						)
+						WHERE storage_cids.state_leaf_key = $1
+						AND storage_cids.storage_leaf_key = $2
+						AND header_cids.block_number <= (SELECT block_number FROM target)
+						AND header_cids.canonical
+						ORDER BY header_cids.block_number DESC
+						LIMIT 1`
+)
+
+// DefaultStatements are the statements used with the default schemas of ipld-eth-db
+var DefaultStatements = NewStatements(StatementConfig{})
+
+var (
+	GetContractCodePgStr = DefaultStatements.ContractCode
+	GetStateAccount      = DefaultStatements.StateAccount
+	GetStorageSlot       = DefaultStatements.StorageSlot
 )
 
+// StatementConfig configures the SQL statements used to read state
+type StatementConfig struct {
+	// EthSchema and IPLDSchema are the schemas of the eth and ipld tables; if empty, the
+	// ipld-eth-db defaults "eth" and "ipld" are used.
+	EthSchema  string
+	IPLDSchema string
+	// FunctionSchema is the schema of the get_storage_at_by_hash function; if empty, the
+	// function is resolved through the search path.
+	FunctionSchema string
+	// InlineStorage reads storage slots with inline SQL rather than through the
+	// get_storage_at_by_hash stored function, which reads from the default eth schema. It's
+	// implied when EthSchema is set to another schema without setting FunctionSchema, so that
+	// storage is read from the same schema as accounts.
+	InlineStorage bool
+}
+
+// Statements is the set of SQL statements used to read state
+type Statements struct {
+	ContractCode string
+	StateAccount string
+	StorageSlot  string
+}
+
+// NewStatements returns the statements for the given configuration
+func NewStatements(config StatementConfig) Statements {
+	storage := storageSlotTemplate
+	if config.InlineStorage || (config.ethSchema() != defaultEthSchema && config.FunctionSchema == "") {
+		storage = inlineStorageSlotTemplate
+	}
+	return Statements{
+		ContractCode: config.Expand(contractCodeTemplate),
+		StateAccount: config.Expand(stateAccountTemplate),
+		StorageSlot:  config.Expand(storage),
+	}
+}
+
+// Expand replaces the {eth}, {ipld} and {fn} placeholders of a statement template with the
+// configured schemas, so that other statements over the same tables follow the configuration
+func (config StatementConfig) Expand(template string) string {
+	ipld := config.IPLDSchema
+	if ipld == "" {
+		ipld = defaultIPLDSchema
+	}
+	fn := ""
+	if config.FunctionSchema != "" {
+		fn = config.FunctionSchema + "."
+	}
+	return strings.NewReplacer("{eth}", config.ethSchema(), "{ipld}", ipld, "{fn}", fn).Replace(template)
+}
+
+func (config StatementConfig) ethSchema() string {
+	if config.EthSchema == "" {
+		return defaultEthSchema
+	}
+	return config.EthSchema
+}
+
+// All returns all statements of the set
+func (s Statements) All() []string {
+	return []string{s.ContractCode, s.StateAccount, s.StorageSlot}
+}
+
 // StorageSlotResult struct for unpacking GetStorageSlot result
 type StorageSlotResult struct {
 	Value            []byte `db:"val"`
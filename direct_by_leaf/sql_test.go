@@ -0,0 +1,39 @@
+package state_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	state "github.com/cerc-io/ipld-eth-statedb/direct_by_leaf"
+)
+
+func TestStatements(t *testing.T) {
+	require.Equal(t, state.DefaultStatements, state.NewStatements(state.StatementConfig{
+		EthSchema:  "eth",
+		IPLDSchema: "ipld",
+	}))
+	require.Contains(t, state.DefaultStatements.StorageSlot, "FROM get_storage_at_by_hash(")
+
+	stmts := state.NewStatements(state.StatementConfig{
+		EthSchema:      "chain2_eth",
+		IPLDSchema:     "chain2_ipld",
+		FunctionSchema: "chain2",
+	})
+	require.Contains(t, stmts.ContractCode, "FROM chain2_ipld.blocks")
+	require.Contains(t, stmts.StorageSlot, "FROM chain2.get_storage_at_by_hash(")
+	require.NotContains(t, stmts.StateAccount, " eth.")
+
+	stmts = state.NewStatements(state.StatementConfig{EthSchema: "chain2_eth", InlineStorage: true})
+	require.NotContains(t, stmts.StorageSlot, "get_storage_at_by_hash")
+	for _, stmt := range stmts.All() {
+		require.False(t, strings.Contains(stmt, "{"), "unexpanded template in %s", stmt)
+		require.NotContains(t, stmt, " eth.")
+	}
+
+	// the stored function reads from the default schema, so isn't used with another one
+	require.Equal(t, stmts, state.NewStatements(state.StatementConfig{EthSchema: "chain2_eth"}))
+	stmts = state.NewStatements(state.StatementConfig{InlineStorage: true})
+	require.Contains(t, stmts.StorageSlot, "FROM eth.storage_cids")
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"time"
 
 	"github.com/VictoriaMetrics/fastcache"
 	lru "github.com/hashicorp/golang-lru"
@@ -43,31 +44,73 @@ var _ StateDatabase = &stateDatabase{}
 
 type stateDatabase struct {
 	db            sql.Database
+	stmts         Statements
 	codeSizeCache *lru.Cache
 	codeCache     *fastcache.Cache
 }
 
 // NewStateDatabase returns a new Database implementation using the passed parameters
 func NewStateDatabase(db sql.Database) *stateDatabase {
+	return newStateDatabase(db, DefaultStatements)
+}
+
+// NewStateDatabaseWithConfig returns a new Database implementation using the statements of the
+// given configuration, which are prepared if the driver supports it
+func NewStateDatabaseWithConfig(ctx context.Context, db sql.Database, config StatementConfig) (*stateDatabase, error) {
+	sd := newStateDatabase(db, NewStatements(config))
+	if err := sd.prepare(ctx); err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	return sd, nil
+}
+
+func newStateDatabase(db sql.Database, stmts Statements) *stateDatabase {
 	csc, _ := lru.New(codeSizeCacheSize)
 	return &stateDatabase{
 		db:            db,
+		stmts:         stmts,
 		codeSizeCache: csc,
 		codeCache:     fastcache.New(codeCacheSize),
 	}
 }
 
+func (sd *stateDatabase) prepare(ctx context.Context) error {
+	p, ok := sd.db.(sql.Preparer)
+	if !ok {
+		return nil
+	}
+	for _, stmt := range sd.stmts.All() {
+		if err := p.Prepare(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ContractCode satisfies Database, it returns the contract code for a given codehash
 func (sd *stateDatabase) ContractCode(codeHash common.Hash) ([]byte, error) {
 	if code := sd.codeCache.Get(nil, codeHash.Bytes()); len(code) > 0 {
+		codeCacheHitMeter.Mark(1)
 		return code, nil
 	}
+	codeCacheMissMeter.Mark(1)
+	return sd.queryCode(codeHash)
+}
+
+// queryCode reads the code for a codehash from the database, and caches it
+func (sd *stateDatabase) queryCode(codeHash common.Hash) ([]byte, error) {
 	c, err := util.Keccak256ToCid(ipld.RawBinary, codeHash.Bytes())
 	if err != nil {
 		return nil, fmt.Errorf("cannot derive CID from provided codehash: %s", err.Error())
 	}
 	code := make([]byte, 0)
-	if err := sd.db.QueryRow(context.Background(), GetContractCodePgStr, c.String()).Scan(&code); err != nil {
+	start := time.Now()
+	err = sd.db.QueryRow(context.Background(), sd.stmts.ContractCode, c.String()).Scan(&code)
+	codeQueryTimer.UpdateSince(start)
+	if err != nil {
+		if sql.IsNoRows(err) {
+			codeNotFoundMeter.Mark(1)
+		}
 		return nil, err
 	}
 	if len(code) > 0 {
@@ -75,27 +118,50 @@ func (sd *stateDatabase) ContractCode(codeHash common.Hash) ([]byte, error) {
 		sd.codeSizeCache.Add(codeHash, len(code))
 		return code, nil
 	}
+	codeNotFoundMeter.Mark(1)
 	return nil, errNotFound
 }
 
-// ContractCodeSize satisfies Database, it returns the length of the code for a provided codehash
+func (sd *stateDatabase) hasCode(codeHash common.Hash) bool {
+	return sd.codeCache.Has(codeHash.Bytes())
+}
+
+func (sd *stateDatabase) hasCodeSize(codeHash common.Hash) bool {
+	return sd.codeSizeCache.Contains(codeHash)
+}
+
+// ContractCodeSize satisfies Database, it returns the length of the code for a provided codehash.
+// A miss of the size cache only marks the code size meters, even if the code itself is cached.
 func (sd *stateDatabase) ContractCodeSize(codeHash common.Hash) (int, error) {
 	if cached, ok := sd.codeSizeCache.Get(codeHash); ok {
+		codeSizeCacheHitMeter.Mark(1)
 		return cached.(int), nil
 	}
-	code, err := sd.ContractCode(codeHash)
+	codeSizeCacheMissMeter.Mark(1)
+	if code := sd.codeCache.Get(nil, codeHash.Bytes()); len(code) > 0 {
+		sd.codeSizeCache.Add(codeHash, len(code))
+		return len(code), nil
+	}
+	code, err := sd.queryCode(codeHash)
 	return len(code), err
 }
 
 // StateAccount satisfies Database, it returns the types.StateAccount for a provided address and block hash
 func (sd *stateDatabase) StateAccount(addressHash, blockHash common.Hash) (*types.StateAccount, error) {
 	res := StateAccountResult{}
-	err := sd.db.QueryRow(context.Background(), GetStateAccount, addressHash.Hex(), blockHash.Hex()).
+	start := time.Now()
+	ctx := sql.WithBlockHash(context.Background(), blockHash)
+	err := sd.db.QueryRow(ctx, sd.stmts.StateAccount, addressHash.Hex(), blockHash.Hex()).
 		Scan(&res.Balance, &res.Nonce, &res.CodeHash, &res.StorageRoot, &res.Removed)
+	accountQueryTimer.UpdateSince(start)
 	if err != nil {
+		if sql.IsNoRows(err) {
+			accountNotFoundMeter.Mark(1)
+		}
 		return nil, err
 	}
 	if res.Removed {
+		accountRemovedMeter.Mark(1)
 		// TODO: check expected behavior for deleted/non existing accounts
 		return nil, nil
 	}
@@ -113,13 +179,20 @@ func (sd *stateDatabase) StateAccount(addressHash, blockHash common.Hash) (*type
 // and block hash
 func (sd *stateDatabase) StorageValue(addressHash, slotHash, blockHash common.Hash) ([]byte, error) {
 	res := StorageSlotResult{}
-	err := sd.db.QueryRow(context.Background(), GetStorageSlot,
+	start := time.Now()
+	ctx := sql.WithBlockHash(context.Background(), blockHash)
+	err := sd.db.QueryRow(ctx, sd.stmts.StorageSlot,
 		addressHash.Hex(), slotHash.Hex(), blockHash.Hex()).
 		Scan(&res.Value, &res.Removed, &res.StateLeafRemoved)
+	storageQueryTimer.UpdateSince(start)
 	if err != nil {
+		if sql.IsNoRows(err) {
+			storageNotFoundMeter.Mark(1)
+		}
 		return nil, err
 	}
 	if res.Removed || res.StateLeafRemoved {
+		storageRemovedMeter.Mark(1)
 		// TODO: check expected behavior for deleted/non existing accounts
 		return nil, nil
 	}
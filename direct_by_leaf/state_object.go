@@ -110,11 +110,13 @@ func newObject(db *StateDB, address common.Address, data types.StateAccount, blo
 	}
 }
 
-// setError remembers the first non-nil error it is called with.
+// setError remembers the first non-nil error it is called with, and passes it
+// on to the owning StateDB.
 func (s *stateObject) setError(err error) {
 	if s.dbErr == nil {
 		s.dbErr = err
 	}
+	s.db.setError(err)
 }
 
 func (s *stateObject) markSuicided() {
@@ -125,6 +127,9 @@ func (s *stateObject) touch() {
 	s.db.journal.append(touchChange{
 		account: &s.address,
 	})
+	if s.db.recorder != nil {
+		s.db.recorder.OnAccountWrite(s.address)
+	}
 	if s.address == ripemd {
 		// Explicitly put it in the dirty-cache, which is otherwise generated from
 		// flattened journals.
@@ -176,6 +181,9 @@ func (s *stateObject) GetCommittedState(db StateDatabase, key common.Hash) commo
 		}
 		value.SetBytes(content)
 	}
+	if s.db.recorder != nil {
+		s.db.recorder.OnSlotLoad(s.address, key, value)
+	}
 	s.originStorage[key] = value
 	return value
 }
@@ -198,6 +206,9 @@ func (s *stateObject) SetState(db StateDatabase, key, value common.Hash) {
 		key:      key,
 		prevalue: prev,
 	})
+	if s.db.recorder != nil {
+		s.db.recorder.OnSlotWrite(s.address, key)
+	}
 	s.setState(key, value)
 }
 
@@ -251,6 +262,9 @@ func (s *stateObject) SetBalance(amount *big.Int) {
 		account: &s.address,
 		prev:    new(big.Int).Set(s.data.Balance),
 	})
+	if s.db.recorder != nil {
+		s.db.recorder.OnAccountWrite(s.address)
+	}
 	s.setBalance(amount)
 }
 
@@ -275,6 +289,9 @@ func (s *stateObject) Code(db StateDatabase) []byte {
 	if bytes.Equal(s.CodeHash(), emptyCodeHash) {
 		return nil
 	}
+	if s.db.recorder != nil {
+		s.db.recorder.OnCodeRead(s.address)
+	}
 	code, err := db.ContractCode(common.BytesToHash(s.CodeHash()))
 	if err != nil {
 		s.setError(fmt.Errorf("can't load code hash %x: %v", s.CodeHash(), err))
@@ -293,6 +310,9 @@ func (s *stateObject) CodeSize(db StateDatabase) int {
 	if bytes.Equal(s.CodeHash(), emptyCodeHash) {
 		return 0
 	}
+	if s.db.recorder != nil {
+		s.db.recorder.OnCodeRead(s.address)
+	}
 	size, err := db.ContractCodeSize(common.BytesToHash(s.CodeHash()))
 	if err != nil {
 		s.setError(fmt.Errorf("can't load code size %x: %v", s.CodeHash(), err))
@@ -307,6 +327,9 @@ func (s *stateObject) SetCode(codeHash common.Hash, code []byte) {
 		prevhash: s.CodeHash(),
 		prevcode: prevcode,
 	})
+	if s.db.recorder != nil {
+		s.db.recorder.OnCodeWrite(s.address)
+	}
 	s.setCode(codeHash, code)
 }
 
@@ -321,6 +344,9 @@ func (s *stateObject) SetNonce(nonce uint64) {
 		account: &s.address,
 		prev:    s.data.Nonce,
 	})
+	if s.db.recorder != nil {
+		s.db.recorder.OnAccountWrite(s.address)
+	}
 	s.setNonce(nonce)
 }
 
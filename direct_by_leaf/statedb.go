@@ -12,6 +12,8 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/params"
+
+	"github.com/cerc-io/ipld-eth-statedb/internal/recorder"
 )
 
 /*
@@ -85,6 +87,9 @@ type StateDB struct {
 	validRevisions []revision
 	nextRevisionId int
 
+	// Optional record of all state accessed, with its pre-values
+	recorder *AccessRecord
+
 	// Measurements gathered during execution for debugging purposes
 	AccountReads time.Duration
 	StorageReads time.Duration
@@ -116,6 +121,29 @@ func (s *StateDB) setError(err error) {
 	}
 }
 
+// Error returns the memorized database failure occurred earlier.
+func (s *StateDB) Error() error {
+	return s.dbErr
+}
+
+// StartRecorder enables recording of all accounts, storage slots and code accessed through
+// the StateDB, along with their values as loaded from the database. Only state loaded after
+// this point is recorded, so it should be called before execution begins.
+func (s *StateDB) StartRecorder() {
+	if s.recorder == nil {
+		s.recorder = recorder.New()
+	}
+}
+
+// Recording returns a copy of the state accesses recorded so far, or nil if recording
+// is not enabled.
+func (s *StateDB) Recording() *AccessRecord {
+	if s.recorder == nil {
+		return nil
+	}
+	return s.recorder.Copy()
+}
+
 func (s *StateDB) AddLog(log *types.Log) {
 	s.journal.append(addLogChange{txhash: s.thash})
 
@@ -308,6 +336,9 @@ func (s *StateDB) Suicide(addr common.Address) bool {
 	})
 	stateObject.markSuicided()
 	stateObject.data.Balance = new(big.Int)
+	if s.recorder != nil {
+		s.recorder.OnAccountWrite(addr)
+	}
 
 	return true
 }
@@ -376,6 +407,9 @@ func (s *StateDB) getDeletedStateObject(addr common.Address) *stateObject {
 		s.setError(fmt.Errorf("getDeletedStateObject (%x) error: %w", addr.Bytes(), err))
 		return nil
 	}
+	if s.recorder != nil {
+		s.recorder.OnAccountLoad(addr, data)
+	}
 	if data == nil {
 		return nil
 	}
@@ -417,6 +451,9 @@ func (s *StateDB) createObject(addr common.Address) (newobj, prev *stateObject)
 		s.journal.append(resetObjectChange{prev: prev, prevdestruct: prevdestruct}) // NOTE: prevdestruct used to be set here from snapshot
 	}
 	s.setStateObject(newobj)
+	if s.recorder != nil {
+		s.recorder.OnAccountWrite(addr)
+	}
 	if prev != nil && !prev.deleted {
 		return newobj, prev
 	}
@@ -675,5 +712,9 @@ func (s *StateDB) Copy() *StateDB {
 	state.accessList = s.accessList.Copy()
 	state.transientStorage = s.transientStorage.Copy()
 
+	if s.recorder != nil {
+		state.recorder = s.recorder.Copy()
+	}
+
 	return state
 }
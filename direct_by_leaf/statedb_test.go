@@ -115,6 +115,12 @@ func TestPGXSuite(t *testing.T) {
 	db := state.NewStateDatabase(database)
 	require.NoError(t, err)
 	testSuite(t, db)
+
+	t.Run("inline storage", func(t *testing.T) {
+		db, err := state.NewStateDatabaseWithConfig(testCtx, database, state.StatementConfig{InlineStorage: true})
+		require.NoError(t, err)
+		testSuite(t, db)
+	})
 }
 
 func TestSQLXSuite(t *testing.T) {
@@ -140,9 +146,15 @@ func TestSQLXSuite(t *testing.T) {
 	db := state.NewStateDatabase(database)
 	require.NoError(t, err)
 	testSuite(t, db)
+
+	t.Run("inline storage", func(t *testing.T) {
+		db, err := state.NewStateDatabaseWithConfig(testCtx, database, state.StatementConfig{InlineStorage: true})
+		require.NoError(t, err)
+		testSuite(t, db)
+	})
 }
 
-func insertSuiteData(t *testing.T, database sql.Database) {
+func insertSuiteData(t testing.TB, database sql.Database) {
 	require.NoError(t, insertHeaderCID(database, BlockHash.String(), BlockParentHash.String(), BlockNumber.Uint64(), true))
 	require.NoError(t, insertHeaderCID(database, BlockHash2.String(), BlockHash.String(), BlockNumber2, true))
 	require.NoError(t, insertHeaderCID(database, BlockHash3.String(), BlockHash2.String(), BlockNumber3, true))
@@ -0,0 +1,110 @@
+package state
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the spans emitted by TracedStateDatabase
+const tracerName = "github.com/cerc-io/ipld-eth-statedb/direct_by_leaf"
+
+var _ StateDatabase = &TracedStateDatabase{}
+
+// codeCacheReader is implemented by StateDatabases which cache code, to report cache hits
+type codeCacheReader interface {
+	hasCode(codeHash common.Hash) bool
+	hasCodeSize(codeHash common.Hash) bool
+}
+
+// TracedStateDatabase wraps a StateDatabase, emitting a span for each call. The database
+// interface carries no context, so spans are parented to the context given on creation,
+// typically that of the request the StateDB serves.
+type TracedStateDatabase struct {
+	ctx    context.Context
+	db     StateDatabase
+	tracer trace.Tracer
+}
+
+// NewTracedStateDatabase returns a StateDatabase tracing the calls to the given database
+// with the given provider, or the global provider if nil
+func NewTracedStateDatabase(ctx context.Context, db StateDatabase, provider trace.TracerProvider) *TracedStateDatabase {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &TracedStateDatabase{ctx: ctx, db: db, tracer: provider.Tracer(tracerName)}
+}
+
+// ContractCode satisfies StateDatabase
+func (t *TracedStateDatabase) ContractCode(codeHash common.Hash) ([]byte, error) {
+	span := t.start("StateDatabase.ContractCode", attribute.String("eth.code_hash", codeHash.Hex()))
+	defer span.End()
+
+	if cache, ok := t.db.(codeCacheReader); ok {
+		span.SetAttributes(attribute.Bool("cache.hit", cache.hasCode(codeHash)))
+	}
+	code, err := t.db.ContractCode(codeHash)
+	endSpan(span, err)
+	return code, err
+}
+
+// ContractCodeSize satisfies StateDatabase
+func (t *TracedStateDatabase) ContractCodeSize(codeHash common.Hash) (int, error) {
+	span := t.start("StateDatabase.ContractCodeSize", attribute.String("eth.code_hash", codeHash.Hex()))
+	defer span.End()
+
+	if cache, ok := t.db.(codeCacheReader); ok {
+		span.SetAttributes(attribute.Bool("cache.hit", cache.hasCodeSize(codeHash)))
+	}
+	size, err := t.db.ContractCodeSize(codeHash)
+	endSpan(span, err)
+	return size, err
+}
+
+// StateAccount satisfies StateDatabase
+func (t *TracedStateDatabase) StateAccount(addressHash, blockHash common.Hash) (*types.StateAccount, error) {
+	span := t.start("StateDatabase.StateAccount",
+		attribute.String("eth.address_hash", addressHash.Hex()),
+		attribute.String("eth.block_hash", blockHash.Hex()))
+	defer span.End()
+
+	acct, err := t.db.StateAccount(addressHash, blockHash)
+	if err == nil {
+		span.SetAttributes(attribute.Bool("eth.found", acct != nil))
+	}
+	endSpan(span, err)
+	return acct, err
+}
+
+// StorageValue satisfies StateDatabase
+func (t *TracedStateDatabase) StorageValue(addressHash, slotHash, blockHash common.Hash) ([]byte, error) {
+	span := t.start("StateDatabase.StorageValue",
+		attribute.String("eth.address_hash", addressHash.Hex()),
+		attribute.String("eth.slot_hash", slotHash.Hex()),
+		attribute.String("eth.block_hash", blockHash.Hex()))
+	defer span.End()
+
+	val, err := t.db.StorageValue(addressHash, slotHash, blockHash)
+	if err == nil {
+		span.SetAttributes(attribute.Bool("eth.found", val != nil))
+	}
+	endSpan(span, err)
+	return val, err
+}
+
+func (t *TracedStateDatabase) start(name string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := t.tracer.Start(t.ctx, name, trace.WithAttributes(attrs...))
+	return span
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,73 @@
+package state_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	state "github.com/cerc-io/ipld-eth-statedb/direct_by_leaf"
+	"github.com/cerc-io/ipld-eth-statedb/sql"
+)
+
+// codeDriver is a sql.Driver serving the same code for any query
+type codeDriver struct {
+	code []byte
+}
+
+func (d codeDriver) QueryRow(ctx context.Context, sql string, args ...interface{}) sql.ScannableRow {
+	return d
+}
+
+func (d codeDriver) Exec(ctx context.Context, sql string, args ...interface{}) (sql.Result, error) {
+	panic("unexpected Exec")
+}
+
+func (d codeDriver) Scan(dest ...interface{}) error {
+	*dest[0].(*[]byte) = d.code
+	return nil
+}
+
+func spanAttrs(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+
+	code := []byte{0x60, 0x00}
+	codeHash := crypto.Keccak256Hash(code)
+	driver := sql.NewTracedDriver(codeDriver{code: code}, provider)
+	db := state.NewTracedStateDatabase(ctx, state.NewStateDatabase(driver), provider)
+
+	for i := 0; i < 2; i++ {
+		have, err := db.ContractCode(codeHash)
+		require.NoError(t, err)
+		require.Equal(t, code, have)
+	}
+	parent.End()
+
+	// the query is only made on the cache miss
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 4)
+	require.Equal(t, "sql.QueryRow", spans[0].Name)
+	require.Equal(t, state.GetContractCodePgStr, spanAttrs(spans[0])["db.statement"].AsString())
+
+	for i, span := range spans[1:3] {
+		require.Equal(t, "StateDatabase.ContractCode", span.Name)
+		require.Equal(t, parent.SpanContext().SpanID(), span.Parent.SpanID())
+		attrs := spanAttrs(span)
+		require.Equal(t, codeHash.Hex(), attrs["eth.code_hash"].AsString())
+		require.Equal(t, i > 0, attrs["cache.hit"].AsBool())
+	}
+}
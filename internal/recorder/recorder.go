@@ -0,0 +1,127 @@
+// Package recorder records the state accessed through the StateDB implementations
+package recorder
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// AccessRecord holds all the state accessed through a StateDB while recording was enabled,
+// along with the values loaded from the database, i.e. the pre-state of the execution.
+type AccessRecord struct {
+	Accounts map[common.Address]*AccountRecord
+}
+
+// AccountRecord describes the accesses to a single account
+type AccountRecord struct {
+	// Pre is the account as loaded from the database, or nil if it did not exist
+	Pre *types.StateAccount
+	// Written is set if the account's fields or existence were modified
+	Written bool
+	// CodeRead is set if the account's code or code size was loaded
+	CodeRead bool
+	// CodeWritten is set if the account's code was replaced
+	CodeWritten bool
+	// Storage holds the accessed slots, keyed by (unhashed) slot
+	Storage map[common.Hash]*SlotRecord
+}
+
+// SlotRecord describes the accesses to a single storage slot
+type SlotRecord struct {
+	Pre     common.Hash // value as loaded from the database
+	Written bool
+}
+
+// New returns an empty record
+func New() *AccessRecord {
+	return &AccessRecord{Accounts: make(map[common.Address]*AccountRecord)}
+}
+
+// account returns the record for the account, creating it if necessary
+func (r *AccessRecord) account(addr common.Address) *AccountRecord {
+	acct, ok := r.Accounts[addr]
+	if !ok {
+		acct = &AccountRecord{Storage: make(map[common.Hash]*SlotRecord)}
+		r.Accounts[addr] = acct
+	}
+	return acct
+}
+
+// OnAccountLoad records an account loaded from the database, or nil if it doesn't exist
+func (r *AccessRecord) OnAccountLoad(addr common.Address, data *types.StateAccount) {
+	if _, ok := r.Accounts[addr]; ok {
+		return
+	}
+	acct := r.account(addr)
+	if data != nil {
+		acct.Pre = copyAccount(data)
+	}
+}
+
+// OnAccountWrite records a modification of an account's fields or existence
+func (r *AccessRecord) OnAccountWrite(addr common.Address) {
+	r.account(addr).Written = true
+}
+
+// OnCodeRead records a load of an account's code or code size
+func (r *AccessRecord) OnCodeRead(addr common.Address) {
+	r.account(addr).CodeRead = true
+}
+
+// OnCodeWrite records a replacement of an account's code
+func (r *AccessRecord) OnCodeWrite(addr common.Address) {
+	acct := r.account(addr)
+	acct.Written = true
+	acct.CodeWritten = true
+}
+
+// OnSlotLoad records a storage slot loaded from the database
+func (r *AccessRecord) OnSlotLoad(addr common.Address, key, value common.Hash) {
+	acct := r.account(addr)
+	if _, ok := acct.Storage[key]; !ok {
+		acct.Storage[key] = &SlotRecord{Pre: value}
+	}
+}
+
+// OnSlotWrite records a modification of a storage slot
+func (r *AccessRecord) OnSlotWrite(addr common.Address, key common.Hash) {
+	acct := r.account(addr)
+	if slot, ok := acct.Storage[key]; ok {
+		slot.Written = true
+		return
+	}
+	acct.Storage[key] = &SlotRecord{Written: true}
+}
+
+// Copy returns a deep copy of the record
+func (r *AccessRecord) Copy() *AccessRecord {
+	cpy := &AccessRecord{Accounts: make(map[common.Address]*AccountRecord, len(r.Accounts))}
+	for addr, acct := range r.Accounts {
+		acctCpy := &AccountRecord{
+			Written:     acct.Written,
+			CodeRead:    acct.CodeRead,
+			CodeWritten: acct.CodeWritten,
+			Storage:     make(map[common.Hash]*SlotRecord, len(acct.Storage)),
+		}
+		if acct.Pre != nil {
+			acctCpy.Pre = copyAccount(acct.Pre)
+		}
+		for key, slot := range acct.Storage {
+			slotCpy := *slot
+			acctCpy.Storage[key] = &slotCpy
+		}
+		cpy.Accounts[addr] = acctCpy
+	}
+	return cpy
+}
+
+func copyAccount(data *types.StateAccount) *types.StateAccount {
+	cpy := *data
+	if data.Balance != nil {
+		cpy.Balance = new(big.Int).Set(data.Balance)
+	}
+	cpy.CodeHash = common.CopyBytes(data.CodeHash)
+	return &cpy
+}
@@ -1,10 +1,17 @@
 package internal
 
 import (
+	"bytes"
 	"testing"
 	"time"
 
 	pgipfsethdb "github.com/cerc-io/ipfs-ethdb/v5/postgres/v0"
+	"github.com/cerc-io/plugeth-statediff/indexer/ipld"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ipfs/go-cid"
 	"github.com/multiformats/go-multihash"
 )
@@ -25,3 +32,46 @@ func MakeCacheConfig(t testing.TB) pgipfsethdb.CacheConfig {
 		ExpiryDuration: time.Hour,
 	}
 }
+
+// MakeCidState builds a state with go-ethereum's StateDB, then re-keys all committed trie
+// nodes and code by CID into an in-memory database. Nodes are stored under both trie codecs,
+// since the hash-keyed database doesn't distinguish account from storage nodes.
+func MakeCidState(t testing.TB, fill func(*state.StateDB)) (ethdb.Database, common.Hash) {
+	gethdb := rawdb.NewMemoryDatabase()
+	sdb, err := state.New(types.EmptyRootHash, state.NewDatabase(gethdb), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(sdb)
+	root, err := sdb.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sdb.Database().TrieDB().Commit(root, false); err != nil {
+		t.Fatal(err)
+	}
+
+	cidDB := rawdb.NewMemoryDatabase()
+	put := func(codec uint64, hash, blob []byte) {
+		cid, err := Keccak256ToCid(codec, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cidDB.Put(cid.Bytes(), blob); err != nil {
+			t.Fatal(err)
+		}
+	}
+	it := gethdb.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		key := it.Key()
+		switch {
+		case len(key) == common.HashLength:
+			put(ipld.MEthStateTrie, key, it.Value())
+			put(ipld.MEthStorageTrie, key, it.Value())
+		case len(key) == len(rawdb.CodePrefix)+common.HashLength && bytes.HasPrefix(key, rawdb.CodePrefix):
+			put(ipld.RawBinary, key[len(rawdb.CodePrefix):], it.Value())
+		}
+	}
+	return cidDB, root
+}
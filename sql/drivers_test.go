@@ -0,0 +1,62 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cerc-io/plugeth-statediff/indexer/database/sql/postgres"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cerc-io/ipld-eth-statedb/sql"
+	"github.com/cerc-io/ipld-eth-statedb/sql/drivertest"
+)
+
+var testCtx = context.Background()
+
+func connectPGX(t *testing.T) *pgxpool.Pool {
+	testConfig, err := postgres.TestConfig.WithEnv()
+	require.NoError(t, err)
+	pool, err := postgres.ConnectPGX(testCtx, testConfig)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func connectSQLX(t *testing.T) *sqlx.DB {
+	testConfig, err := postgres.TestConfig.WithEnv()
+	require.NoError(t, err)
+	db, err := postgres.ConnectSQLX(testCtx, testConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestPGXDriver(t *testing.T) {
+	drivertest.RunSuite(t, sql.NewPGXDriverFromPool(testCtx, connectPGX(t)))
+}
+
+func TestSQLXDriver(t *testing.T) {
+	drivertest.RunSuite(t, sql.NewSQLXDriverFromPool(testCtx, connectSQLX(t)))
+}
+
+func TestStdDriver(t *testing.T) {
+	drivertest.RunSuite(t, sql.NewStdDriverFromPool(testCtx, connectSQLX(t).DB))
+}
+
+func TestTracedDriver(t *testing.T) {
+	drivertest.RunSuite(t, sql.NewTracedDriver(sql.NewPGXDriverFromPool(testCtx, connectPGX(t)), nil))
+}
+
+func TestReplicaDriver(t *testing.T) {
+	primary := sql.NewPGXDriverFromPool(testCtx, connectPGX(t))
+	replica := sql.NewStdDriverFromPool(testCtx, connectSQLX(t).DB)
+	drivertest.RunSuite(t, sql.NewReplicaDriver(primary, []sql.Driver{replica}, sql.ReplicaConfig{}))
+}
+
+func TestRetryDriver(t *testing.T) {
+	drivertest.RunSuite(t, sql.NewRetryDriver(sql.NewPGXDriverFromPool(testCtx, connectPGX(t)), sql.RetryConfig{
+		BreakerThreshold: 3,
+	}))
+}
@@ -0,0 +1,135 @@
+// Package drivertest provides the test suite which every sql.Driver implementation must pass
+package drivertest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cerc-io/ipld-eth-statedb/sql"
+)
+
+// RunSuite runs the driver test suite against a driver connected to a Postgres database.
+// The suite creates, and drops on cleanup, a table of its own.
+func RunSuite(t *testing.T, driver sql.Driver) {
+	ctx := context.Background()
+	table := fmt.Sprintf("driver_test_%d", rand.Uint32())
+	var (
+		createStmt = fmt.Sprintf(`CREATE TABLE %s (id BIGINT PRIMARY KEY, name TEXT NOT NULL, data BYTEA, flag BOOL NOT NULL)`, table)
+		insertStmt = fmt.Sprintf(`INSERT INTO %s (id, name, data, flag) VALUES ($1, $2, $3, $4)`, table)
+		selectStmt = fmt.Sprintf(`SELECT name, data, flag FROM %s WHERE id = $1`, table)
+		updateStmt = fmt.Sprintf(`UPDATE %s SET flag = $1`, table)
+	)
+	_, err := driver.Exec(ctx, createStmt)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := driver.Exec(ctx, fmt.Sprintf(`DROP TABLE %s`, table))
+		require.NoError(t, err)
+	})
+
+	insert := func(t *testing.T, id int64, name string, data []byte, flag bool) {
+		res, err := driver.Exec(ctx, insertStmt, id, name, data, flag)
+		require.NoError(t, err)
+		affected, err := res.RowsAffected()
+		require.NoError(t, err)
+		require.Equal(t, int64(1), affected)
+	}
+	checkRow := func(t *testing.T, id int64, name string, data []byte, flag bool) {
+		var (
+			haveName string
+			haveData []byte
+			haveFlag bool
+		)
+		require.NoError(t, driver.QueryRow(ctx, selectStmt, id).Scan(&haveName, &haveData, &haveFlag))
+		require.Equal(t, name, haveName)
+		require.Equal(t, data, haveData)
+		require.Equal(t, flag, haveFlag)
+	}
+
+	t.Run("ExecAndQueryRow", func(t *testing.T) {
+		insert(t, 1, "one", []byte{1, 2, 3}, true)
+		insert(t, 2, "two", nil, false)
+		checkRow(t, 1, "one", []byte{1, 2, 3}, true)
+		checkRow(t, 2, "two", nil, false)
+
+		res, err := driver.Exec(ctx, updateStmt, true)
+		require.NoError(t, err)
+		affected, err := res.RowsAffected()
+		require.NoError(t, err)
+		require.Equal(t, int64(2), affected)
+	})
+
+	t.Run("NoRows", func(t *testing.T) {
+		var name string
+		err := driver.QueryRow(ctx, selectStmt, -1).Scan(&name)
+		require.Error(t, err)
+		require.True(t, sql.IsNoRows(err), "expected no rows error, have %v", err)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := driver.Exec(ctx, `INSERT INTO driver_test_missing VALUES (1)`)
+		require.Error(t, err)
+
+		var name string
+		err = driver.QueryRow(ctx, `SELECT name FROM driver_test_missing`).Scan(&name)
+		require.Error(t, err)
+		require.False(t, sql.IsNoRows(err))
+
+		// the driver remains usable
+		checkRow(t, 2, "two", nil, true)
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		var name string
+		require.Error(t, driver.QueryRow(cancelled, selectStmt, 1).Scan(&name))
+		_, err := driver.Exec(cancelled, updateStmt, false)
+		require.Error(t, err)
+		checkRow(t, 1, "one", []byte{1, 2, 3}, true)
+	})
+
+	t.Run("Prepare", func(t *testing.T) {
+		p, ok := driver.(sql.Preparer)
+		if !ok {
+			t.Skip("driver doesn't prepare statements")
+		}
+		for i := 0; i < 2; i++ {
+			require.NoError(t, p.Prepare(ctx, selectStmt))
+			require.NoError(t, p.Prepare(ctx, insertStmt))
+		}
+		insert(t, 3, "three", []byte{3}, false)
+		checkRow(t, 3, "three", []byte{3}, false)
+
+		var name string
+		require.True(t, sql.IsNoRows(driver.QueryRow(ctx, selectStmt, -1).Scan(&name)))
+
+		// closing the statements leaves the driver usable
+		if c, ok := driver.(interface{ Close() error }); ok {
+			require.NoError(t, c.Close())
+			checkRow(t, 3, "three", []byte{3}, false)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 64)
+		for i := 0; i < cap(errs); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var name string
+				errs <- driver.QueryRow(ctx, selectStmt, 1).Scan(&name)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+	})
+}
@@ -0,0 +1,13 @@
+package sql
+
+import (
+	dbsql "database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// IsNoRows reports whether the error is the empty result error of pgx or database/sql
+func IsNoRows(err error) bool {
+	return errors.Is(err, pgx.ErrNoRows) || errors.Is(err, dbsql.ErrNoRows)
+}
@@ -13,6 +13,12 @@ type Driver interface {
 	Exec(ctx context.Context, sql string, args ...interface{}) (Result, error)
 }
 
+// Preparer is implemented by Drivers able to prepare statements ahead of use. Prepared
+// statements are used by QueryRow and Exec when passed the same SQL.
+type Preparer interface {
+	Prepare(ctx context.Context, sql string) error
+}
+
 // ScannableRow interface to accommodate different concrete row types
 type ScannableRow interface {
 	Scan(dest ...interface{}) error
@@ -4,10 +4,12 @@ import (
 	"context"
 
 	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 var _ Driver = &PGXDriver{}
+var _ Preparer = &PGXDriver{}
 
 // PGXDriver driver, implements Driver
 type PGXDriver struct {
@@ -31,6 +33,39 @@ func (pgx *PGXDriver) Exec(ctx context.Context, sql string, args ...interface{})
 	return resultWrapper{ct: res}, err
 }
 
+// Prepare satisfies sql.Preparer. Statements are named by their SQL, and prepared on the
+// idle connections of the pool; use PrepareOnConnect to also prepare them on new connections.
+// With the default pool config, pgx's statement cache already prepares each statement once per
+// connection as it's used, so preparing them here leaves the pgx side effectively unchanged:
+// it only checks the statements up front and saves their first use on each connection.
+func (driver *PGXDriver) Prepare(ctx context.Context, sql string) error {
+	conns := driver.db.AcquireAllIdle(ctx)
+	defer func() {
+		for _, conn := range conns {
+			conn.Release()
+		}
+	}()
+	for _, conn := range conns {
+		if _, err := conn.Conn().Prepare(ctx, sql, sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrepareOnConnect returns a pgxpool.Config.AfterConnect hook preparing the statements on
+// each new connection, named by their SQL
+func PrepareOnConnect(statements ...string) func(context.Context, *pgx.Conn) error {
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		for _, sql := range statements {
+			if _, err := conn.Prepare(ctx, sql, sql); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
 type resultWrapper struct {
 	ct pgconn.CommandTag
 }
@@ -0,0 +1,234 @@
+package sql
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// DefaultHeadStatement selects the latest block indexed by a database
+	DefaultHeadStatement = `SELECT COALESCE(MAX(block_number), 0) FROM eth.header_cids`
+	// DefaultBlockNumberStatement selects the number of the block with a hash
+	DefaultBlockNumberStatement = `SELECT block_number FROM eth.header_cids WHERE block_hash = $1 LIMIT 1`
+
+	defaultHeadInterval  = time.Second
+	blockNumberCacheSize = 4096
+
+	// latencyWeight is the weight of the latest latency sample in the moving average
+	latencyWeight = 0.2
+)
+
+// ReplicaPolicy selects the replica a query is routed to
+type ReplicaPolicy int
+
+const (
+	// RoundRobin routes queries to each usable replica in turn
+	RoundRobin ReplicaPolicy = iota
+	// LeastLatency routes queries to the usable replica with the lowest average latency
+	LeastLatency
+)
+
+// ReplicaConfig configures a ReplicaDriver
+type ReplicaConfig struct {
+	Policy ReplicaPolicy
+	// MaxLag is the number of blocks a replica's head may trail the primary's by before the
+	// replica stops being used; zero disables the lag check, so replicas are used however far
+	// they trail, unless the context carries a block hash they haven't indexed.
+	MaxLag uint64
+	// HeadInterval is the interval at which the heads of the databases are refreshed; if zero,
+	// they are refreshed every second.
+	HeadInterval time.Duration
+	// HeadStatement and BlockNumberStatement select the latest indexed block, and the number of
+	// a block by hash; if empty, DefaultHeadStatement and DefaultBlockNumberStatement are used.
+	HeadStatement        string
+	BlockNumberStatement string
+}
+
+type blockHashKey struct{}
+
+// WithBlockHash returns a context for queries reading state as of the given block, which
+// ReplicaDriver only routes to replicas which have indexed the block
+func WithBlockHash(ctx context.Context, hash common.Hash) context.Context {
+	return context.WithValue(ctx, blockHashKey{}, hash)
+}
+
+// BlockHashFromContext returns the block hash set by WithBlockHash, if any
+func BlockHashFromContext(ctx context.Context) (common.Hash, bool) {
+	hash, ok := ctx.Value(blockHashKey{}).(common.Hash)
+	return hash, ok
+}
+
+var _ Driver = &ReplicaDriver{}
+var _ Preparer = &ReplicaDriver{}
+
+// ReplicaDriver is a Driver over a primary database and its read replicas. Exec is always
+// routed to the primary, and QueryRow to a replica which is within the lag tolerance and,
+// if the context carries a block hash, has indexed the block. Otherwise queries fall back
+// to the primary.
+type ReplicaDriver struct {
+	primary  *replica
+	replicas []*replica
+	config   ReplicaConfig
+
+	next   atomic.Uint64
+	blocks *lru.Cache // block hash -> number, as indexed by the primary
+}
+
+// replica tracks the head and latency of a database
+type replica struct {
+	driver  Driver
+	head    atomic.Uint64
+	checked atomic.Int64 // time of the last head refresh, in unix nanoseconds
+	latency atomic.Int64 // moving average of the query latency, in nanoseconds
+	lock    sync.Mutex   // held while refreshing the head
+}
+
+// NewReplicaDriver returns a Driver routing queries between the primary and replicas
+func NewReplicaDriver(primary Driver, replicas []Driver, config ReplicaConfig) *ReplicaDriver {
+	if config.HeadInterval == 0 {
+		config.HeadInterval = defaultHeadInterval
+	}
+	if config.HeadStatement == "" {
+		config.HeadStatement = DefaultHeadStatement
+	}
+	if config.BlockNumberStatement == "" {
+		config.BlockNumberStatement = DefaultBlockNumberStatement
+	}
+	blocks, _ := lru.New(blockNumberCacheSize)
+	rd := &ReplicaDriver{
+		primary: &replica{driver: primary},
+		config:  config,
+		blocks:  blocks,
+	}
+	for _, driver := range replicas {
+		rd.replicas = append(rd.replicas, &replica{driver: driver})
+	}
+	return rd
+}
+
+// QueryRow satisfies sql.Database
+func (rd *ReplicaDriver) QueryRow(ctx context.Context, sql string, args ...interface{}) ScannableRow {
+	r := rd.route(ctx)
+	if r == rd.primary {
+		return r.driver.QueryRow(ctx, sql, args...)
+	}
+	// the query may run in QueryRow, so it's timed from before the call
+	start := time.Now()
+	return &timedRow{row: r.driver.QueryRow(ctx, sql, args...), replica: r, start: start}
+}
+
+// Exec satisfies sql.Database
+func (rd *ReplicaDriver) Exec(ctx context.Context, sql string, args ...interface{}) (Result, error) {
+	return rd.primary.driver.Exec(ctx, sql, args...)
+}
+
+// Prepare satisfies sql.Preparer, preparing the statement on each database which supports it
+func (rd *ReplicaDriver) Prepare(ctx context.Context, sql string) error {
+	for _, r := range append([]*replica{rd.primary}, rd.replicas...) {
+		if p, ok := r.driver.(Preparer); ok {
+			if err := p.Prepare(ctx, sql); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// route selects the database a query is sent to
+func (rd *ReplicaDriver) route(ctx context.Context) *replica {
+	if len(rd.replicas) == 0 {
+		return rd.primary
+	}
+	var required uint64
+	if rd.config.MaxLag > 0 {
+		if head := rd.refreshHead(ctx, rd.primary); head > rd.config.MaxLag {
+			required = head - rd.config.MaxLag
+		}
+	}
+	if hash, ok := BlockHashFromContext(ctx); ok {
+		number, ok := rd.blockNumber(ctx, hash)
+		if !ok {
+			return rd.primary
+		}
+		if number > required {
+			required = number
+		}
+	}
+	usable := make([]*replica, 0, len(rd.replicas))
+	for _, r := range rd.replicas {
+		if required == 0 || rd.refreshHead(ctx, r) >= required {
+			usable = append(usable, r)
+		}
+	}
+	if len(usable) == 0 {
+		return rd.primary
+	}
+	if rd.config.Policy == LeastLatency {
+		best := usable[0]
+		for _, r := range usable[1:] {
+			if r.latency.Load() < best.latency.Load() {
+				best = r
+			}
+		}
+		return best
+	}
+	return usable[(rd.next.Add(1)-1)%uint64(len(usable))]
+}
+
+// blockNumber resolves the number of a block on the primary
+func (rd *ReplicaDriver) blockNumber(ctx context.Context, hash common.Hash) (uint64, bool) {
+	if number, ok := rd.blocks.Get(hash); ok {
+		return number.(uint64), true
+	}
+	var number uint64
+	if err := rd.primary.driver.QueryRow(ctx, rd.config.BlockNumberStatement, hash.Hex()).Scan(&number); err != nil {
+		return 0, false
+	}
+	rd.blocks.Add(hash, number)
+	return number, true
+}
+
+// refreshHead returns the head of a database, refreshing it if it's older than the head
+// interval. Concurrent callers use the previous head while it's being refreshed.
+func (rd *ReplicaDriver) refreshHead(ctx context.Context, r *replica) uint64 {
+	if time.Since(time.Unix(0, r.checked.Load())) < rd.config.HeadInterval || !r.lock.TryLock() {
+		return r.head.Load()
+	}
+	defer r.lock.Unlock()
+
+	var head uint64
+	if err := r.driver.QueryRow(ctx, rd.config.HeadStatement).Scan(&head); err == nil {
+		r.head.Store(head)
+	}
+	r.checked.Store(time.Now().UnixNano())
+	return r.head.Load()
+}
+
+// timedRow records the latency of a replica query once scanned
+type timedRow struct {
+	row     ScannableRow
+	replica *replica
+	start   time.Time
+}
+
+// Scan satisfies sql.ScannableRow
+func (r *timedRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	sample := time.Since(r.start).Nanoseconds()
+	for {
+		prev := r.replica.latency.Load()
+		avg := sample
+		if prev != 0 {
+			avg = int64(latencyWeight*float64(sample) + (1-latencyWeight)*float64(prev))
+		}
+		if r.replica.latency.CompareAndSwap(prev, avg) {
+			break
+		}
+	}
+	return err
+}
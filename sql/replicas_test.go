@@ -0,0 +1,143 @@
+package sql_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cerc-io/ipld-eth-statedb/sql"
+)
+
+const testQuery = `SELECT name FROM test`
+
+// fakeReplica is a Driver answering the head and block number queries of a ReplicaDriver,
+// and testQuery with its name
+type fakeReplica struct {
+	name  string
+	delay time.Duration
+
+	lock    sync.Mutex
+	head    uint64
+	blocks  map[common.Hash]uint64
+	queries int
+	execs   int
+}
+
+type fakeRow struct {
+	val interface{}
+	err error
+}
+
+func (r fakeRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	switch d := dest[0].(type) {
+	case *uint64:
+		*d = r.val.(uint64)
+	case *string:
+		*d = r.val.(string)
+	}
+	return nil
+}
+
+func (f *fakeReplica) QueryRow(ctx context.Context, query string, args ...interface{}) sql.ScannableRow {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	switch query {
+	case sql.DefaultHeadStatement:
+		return fakeRow{val: f.head}
+	case sql.DefaultBlockNumberStatement:
+		number, ok := f.blocks[common.HexToHash(args[0].(string))]
+		if !ok {
+			return fakeRow{err: pgx.ErrNoRows}
+		}
+		return fakeRow{val: number}
+	}
+	f.queries++
+	// like pgx and database/sql, the query runs before the row is returned
+	time.Sleep(f.delay)
+	return fakeRow{val: f.name}
+}
+
+func (f *fakeReplica) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.execs++
+	return nil, errors.New("no result")
+}
+
+func (f *fakeReplica) setHead(head uint64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.head = head
+}
+
+func queryName(t *testing.T, ctx context.Context, db sql.Driver) string {
+	var name string
+	require.NoError(t, db.QueryRow(ctx, testQuery).Scan(&name))
+	return name
+}
+
+func TestReplicaRoundRobin(t *testing.T) {
+	primary := &fakeReplica{name: "primary"}
+	r1, r2 := &fakeReplica{name: "r1"}, &fakeReplica{name: "r2"}
+	db := sql.NewReplicaDriver(primary, []sql.Driver{r1, r2}, sql.ReplicaConfig{})
+
+	var names []string
+	for i := 0; i < 4; i++ {
+		names = append(names, queryName(t, context.Background(), db))
+	}
+	require.Equal(t, []string{"r1", "r2", "r1", "r2"}, names)
+
+	_, err := db.Exec(context.Background(), `DELETE FROM test`)
+	require.Error(t, err)
+	require.Equal(t, 1, primary.execs)
+	require.Zero(t, r1.execs+r2.execs)
+}
+
+func TestReplicaLag(t *testing.T) {
+	block := common.HexToHash("0x01")
+	primary := &fakeReplica{name: "primary", head: 100, blocks: map[common.Hash]uint64{block: 98}}
+	replica := &fakeReplica{name: "replica", head: 90}
+	db := sql.NewReplicaDriver(primary, []sql.Driver{replica}, sql.ReplicaConfig{
+		MaxLag:       5,
+		HeadInterval: time.Nanosecond,
+	})
+	ctx := sql.WithBlockHash(context.Background(), block)
+
+	// the replica trails the primary by more than the tolerance
+	require.Equal(t, "primary", queryName(t, context.Background(), db))
+
+	// within the tolerance, but the requested block isn't indexed yet
+	replica.setHead(96)
+	require.Equal(t, "replica", queryName(t, context.Background(), db))
+	require.Equal(t, "primary", queryName(t, ctx, db))
+
+	replica.setHead(98)
+	require.Equal(t, "replica", queryName(t, ctx, db))
+
+	// blocks unknown to the primary are queried on the primary
+	unknown := sql.WithBlockHash(context.Background(), common.HexToHash("0x02"))
+	require.Equal(t, "primary", queryName(t, unknown, db))
+}
+
+func TestReplicaLeastLatency(t *testing.T) {
+	primary := &fakeReplica{name: "primary"}
+	slow := &fakeReplica{name: "slow", delay: 10 * time.Millisecond}
+	fast := &fakeReplica{name: "fast"}
+	db := sql.NewReplicaDriver(primary, []sql.Driver{slow, fast}, sql.ReplicaConfig{Policy: sql.LeastLatency})
+
+	// replicas without samples are tried first
+	require.Equal(t, "slow", queryName(t, context.Background(), db))
+	for i := 0; i < 4; i++ {
+		require.Equal(t, "fast", queryName(t, context.Background(), db))
+	}
+}
@@ -0,0 +1,270 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+const (
+	defaultMaxAttempts     = 3
+	defaultInitialBackoff  = 50 * time.Millisecond
+	defaultMaxBackoff      = time.Second
+	defaultBreakerCooldown = 5 * time.Second
+)
+
+// ErrCircuitOpen is returned without querying the database while the circuit breaker is open
+var ErrCircuitOpen = errors.New("database circuit breaker is open")
+
+// circuitOpenError is returned when the circuit breaker opens while a statement is retried,
+// wrapping the error of the last attempt
+type circuitOpenError struct {
+	err error
+}
+
+func (e *circuitOpenError) Error() string {
+	return ErrCircuitOpen.Error() + ": " + e.err.Error()
+}
+
+func (e *circuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+func (e *circuitOpenError) Unwrap() error {
+	return e.err
+}
+
+// ErrorClass is the classification of a database error
+type ErrorClass int
+
+const (
+	// Permanent errors are returned as they are
+	Permanent ErrorClass = iota
+	// Transient errors abort the statement, so it's safe to retry whether or not it writes
+	Transient
+	// ConnectionLost errors leave unknown whether the statement was applied, so only reads
+	// are retried
+	ConnectionLost
+)
+
+// ClassifyError classifies an error by its Postgres error code, or as a connection error.
+// Of the connection exceptions, only failures to establish the connection are Transient.
+func ClassifyError(err error) ErrorClass {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return Permanent
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "40001", // serialization_failure
+			pgErr.Code == "40P01", // deadlock_detected
+			pgErr.Code == "53300", // too_many_connections
+			pgErr.Code == "57P03", // cannot_connect_now
+			pgErr.Code == "08001", // sqlclient_unable_to_establish_sqlconnection
+			pgErr.Code == "08004": // sqlserver_rejected_establishment_of_sqlconnection
+			return Transient
+		case pgErr.Code == "57P01", // admin_shutdown
+			pgErr.Code == "57P02",               // crash_shutdown
+			strings.HasPrefix(pgErr.Code, "08"): // other connection_exception
+			return ConnectionLost
+		}
+		return Permanent
+	}
+	var retryable interface{ SafeToRetry() bool }
+	if errors.As(err, &retryable) && retryable.SafeToRetry() {
+		return Transient
+	}
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.As(err, &netErr) {
+		return ConnectionLost
+	}
+	return Permanent
+}
+
+// RetryConfig configures a RetryDriver
+type RetryConfig struct {
+	// MaxAttempts is the number of times a statement is attempted; if zero, it's attempted
+	// three times.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, which doubles with each retry up to
+	// MaxBackoff; if zero, they are 50ms and 1s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// BreakerThreshold is the number of consecutive failed attempts which opens the circuit
+	// breaker, or zero to disable it. While open, statements fail with ErrCircuitOpen until
+	// BreakerCooldown has passed, then a single statement probes the database; if zero, the
+	// cooldown is 5s.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// Classify classifies errors; if nil, ClassifyError is used
+	Classify func(error) ErrorClass
+}
+
+var _ Driver = &RetryDriver{}
+var _ Preparer = &RetryDriver{}
+
+// RetryDriver wraps a Driver, retrying statements which fail with transient errors with an
+// exponential backoff, and failing fast while the database is unavailable
+type RetryDriver struct {
+	driver  Driver
+	config  RetryConfig
+	breaker *breaker
+}
+
+// NewRetryDriver returns a Driver retrying the statements of the given driver
+func NewRetryDriver(driver Driver, config RetryConfig) *RetryDriver {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultMaxAttempts
+	}
+	if config.InitialBackoff == 0 {
+		config.InitialBackoff = defaultInitialBackoff
+	}
+	if config.MaxBackoff == 0 {
+		config.MaxBackoff = defaultMaxBackoff
+	}
+	if config.BreakerCooldown == 0 {
+		config.BreakerCooldown = defaultBreakerCooldown
+	}
+	if config.Classify == nil {
+		config.Classify = ClassifyError
+	}
+	rd := &RetryDriver{driver: driver, config: config}
+	if config.BreakerThreshold > 0 {
+		rd.breaker = &breaker{threshold: config.BreakerThreshold, cooldown: config.BreakerCooldown}
+	}
+	return rd
+}
+
+// QueryRow satisfies sql.Database. Queries are only retried once scanned.
+func (rd *RetryDriver) QueryRow(ctx context.Context, sql string, args ...interface{}) ScannableRow {
+	return &retryRow{driver: rd, ctx: ctx, sql: sql, args: args}
+}
+
+// Exec satisfies sql.Database. Statements are not retried after losing the connection, as
+// they may have been applied.
+func (rd *RetryDriver) Exec(ctx context.Context, sql string, args ...interface{}) (Result, error) {
+	var res Result
+	err := rd.retry(ctx, false, func() error {
+		var err error
+		res, err = rd.driver.Exec(ctx, sql, args...)
+		return err
+	})
+	return res, err
+}
+
+// Prepare satisfies sql.Preparer, preparing the statement if the wrapped driver supports it
+func (rd *RetryDriver) Prepare(ctx context.Context, sql string) error {
+	p, ok := rd.driver.(Preparer)
+	if !ok {
+		return nil
+	}
+	return rd.retry(ctx, true, func() error {
+		return p.Prepare(ctx, sql)
+	})
+}
+
+// retry attempts fn until it succeeds, fails with an error which can't be retried, or the
+// attempts are exhausted. If the circuit breaker opens between attempts, the error of the
+// last attempt is returned wrapped with ErrCircuitOpen.
+func (rd *RetryDriver) retry(ctx context.Context, read bool, fn func() error) error {
+	backoff := rd.config.InitialBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if rd.breaker != nil && !rd.breaker.allow() {
+			if err != nil {
+				return &circuitOpenError{err: err}
+			}
+			return ErrCircuitOpen
+		}
+		err = fn()
+		class := Permanent
+		if err != nil && !IsNoRows(err) {
+			class = rd.config.Classify(err)
+		}
+		if rd.breaker != nil {
+			rd.breaker.record(class == Permanent)
+		}
+		retryable := class == Transient || (read && class == ConnectionLost)
+		if !retryable || attempt >= rd.config.MaxAttempts {
+			return err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		if backoff *= 2; backoff > rd.config.MaxBackoff {
+			backoff = rd.config.MaxBackoff
+		}
+	}
+}
+
+// retryRow queries and scans a row, retrying both on failure
+type retryRow struct {
+	driver *RetryDriver
+	ctx    context.Context
+	sql    string
+	args   []interface{}
+}
+
+// Scan satisfies sql.ScannableRow
+func (r *retryRow) Scan(dest ...interface{}) error {
+	return r.driver.retry(r.ctx, true, func() error {
+		return r.driver.driver.QueryRow(r.ctx, r.sql, r.args...).Scan(dest...)
+	})
+}
+
+// breaker is a circuit breaker, which opens after consecutive failures, and lets a single
+// probe through once cooled down
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	lock     sync.Mutex
+	failures int
+	openedAt time.Time // zero while closed
+	probing  bool
+}
+
+// allow reports whether a statement may be attempted
+func (b *breaker) allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record records the outcome of an attempt
+func (b *breaker) record(ok bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.probing = false
+	if ok {
+		b.failures = 0
+		b.openedAt = time.Time{}
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
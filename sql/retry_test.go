@@ -0,0 +1,176 @@
+package sql_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cerc-io/ipld-eth-statedb/sql"
+)
+
+var (
+	errSerialization  = &pgconn.PgError{Code: "40001", Message: "could not serialize access"}
+	errUndefinedTable = &pgconn.PgError{Code: "42P01", Message: "relation does not exist"}
+	errConnReset      = &pgconn.PgError{Code: "08006", Message: "connection failure"}
+	errCannotConnect  = &pgconn.PgError{Code: "08001", Message: "unable to establish connection"}
+)
+
+// faultDriver is a Driver failing with the injected faults, one per call, then succeeding
+type faultDriver struct {
+	lock   sync.Mutex
+	faults []error
+	calls  int
+}
+
+func (d *faultDriver) inject(faults ...error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.faults = append(d.faults, faults...)
+}
+
+func (d *faultDriver) next() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.calls++
+	if len(d.faults) == 0 {
+		return nil
+	}
+	err := d.faults[0]
+	d.faults = d.faults[1:]
+	return err
+}
+
+func (d *faultDriver) callCount() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.calls
+}
+
+func (d *faultDriver) QueryRow(ctx context.Context, query string, args ...interface{}) sql.ScannableRow {
+	return fakeRow{val: "ok", err: d.next()}
+}
+
+func (d *faultDriver) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, d.next()
+}
+
+func TestClassifyError(t *testing.T) {
+	require.Equal(t, sql.Transient, sql.ClassifyError(errSerialization))
+	require.Equal(t, sql.ConnectionLost, sql.ClassifyError(errConnReset))
+	require.Equal(t, sql.Transient, sql.ClassifyError(errCannotConnect))
+	require.Equal(t, sql.Transient, sql.ClassifyError(&pgconn.PgError{Code: "08004"}))
+	require.Equal(t, sql.ConnectionLost, sql.ClassifyError(&pgconn.PgError{Code: "08003"}))
+	require.Equal(t, sql.Transient, sql.ClassifyError(&pgconn.PgError{Code: "40P01"}))
+	require.Equal(t, sql.ConnectionLost, sql.ClassifyError(&pgconn.PgError{Code: "57P01"}))
+	require.Equal(t, sql.ConnectionLost, sql.ClassifyError(io.ErrUnexpectedEOF))
+	require.Equal(t, sql.Permanent, sql.ClassifyError(errUndefinedTable))
+	require.Equal(t, sql.Permanent, sql.ClassifyError(context.Canceled))
+	require.Equal(t, sql.Permanent, sql.ClassifyError(errors.New("unknown")))
+}
+
+func TestRetryQueryRow(t *testing.T) {
+	fd := &faultDriver{}
+	db := sql.NewRetryDriver(fd, sql.RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+	var val string
+	fd.inject(errSerialization, io.ErrUnexpectedEOF)
+	require.NoError(t, db.QueryRow(testCtx, testQuery).Scan(&val))
+	require.Equal(t, "ok", val)
+	require.Equal(t, 3, fd.callCount())
+
+	// attempts are exhausted
+	fd.inject(errConnReset, errConnReset, errConnReset)
+	err := db.QueryRow(testCtx, testQuery).Scan(&val)
+	require.ErrorIs(t, err, errConnReset)
+	require.Equal(t, 6, fd.callCount())
+
+	// permanent errors and empty results are not retried
+	fd.inject(errUndefinedTable)
+	require.ErrorIs(t, db.QueryRow(testCtx, testQuery).Scan(&val), errUndefinedTable)
+	fd.inject(pgx.ErrNoRows)
+	require.True(t, sql.IsNoRows(db.QueryRow(testCtx, testQuery).Scan(&val)))
+	require.Equal(t, 8, fd.callCount())
+}
+
+func TestRetryExec(t *testing.T) {
+	fd := &faultDriver{}
+	db := sql.NewRetryDriver(fd, sql.RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+	fd.inject(errSerialization)
+	_, err := db.Exec(testCtx, testQuery)
+	require.NoError(t, err)
+	require.Equal(t, 2, fd.callCount())
+
+	// the statement may have been applied before the connection was lost
+	fd.inject(io.ErrUnexpectedEOF)
+	_, err = db.Exec(testCtx, testQuery)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.Equal(t, 3, fd.callCount())
+	fd.inject(errConnReset)
+	_, err = db.Exec(testCtx, testQuery)
+	require.ErrorIs(t, err, errConnReset)
+	require.Equal(t, 4, fd.callCount())
+
+	// the connection was never established
+	fd.inject(errCannotConnect)
+	_, err = db.Exec(testCtx, testQuery)
+	require.NoError(t, err)
+	require.Equal(t, 6, fd.callCount())
+}
+
+func TestRetryContext(t *testing.T) {
+	fd := &faultDriver{}
+	db := sql.NewRetryDriver(fd, sql.RetryConfig{MaxAttempts: 3, InitialBackoff: time.Hour})
+
+	ctx, cancel := context.WithTimeout(testCtx, 10*time.Millisecond)
+	defer cancel()
+	var val string
+	fd.inject(errSerialization)
+	require.ErrorIs(t, db.QueryRow(ctx, testQuery).Scan(&val), errSerialization)
+	require.Equal(t, 1, fd.callCount())
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	fd := &faultDriver{}
+	cooldown := 20 * time.Millisecond
+	db := sql.NewRetryDriver(fd, sql.RetryConfig{
+		MaxAttempts:      2,
+		InitialBackoff:   time.Millisecond,
+		BreakerThreshold: 3,
+		BreakerCooldown:  cooldown,
+	})
+
+	// the breaker opens on the third consecutive failure
+	var val string
+	fd.inject(errConnReset, errConnReset, errConnReset, errConnReset)
+	require.ErrorIs(t, db.QueryRow(testCtx, testQuery).Scan(&val), errConnReset)
+	err := db.QueryRow(testCtx, testQuery).Scan(&val)
+	require.ErrorIs(t, err, sql.ErrCircuitOpen)
+	require.ErrorIs(t, err, errConnReset)
+	require.Equal(t, 3, fd.callCount())
+
+	// the database isn't queried until cooled down
+	_, err = db.Exec(testCtx, testQuery)
+	require.Equal(t, sql.ErrCircuitOpen, err)
+	require.Equal(t, 3, fd.callCount())
+
+	// a failed probe reopens the breaker
+	time.Sleep(cooldown)
+	err = db.QueryRow(testCtx, testQuery).Scan(&val)
+	require.ErrorIs(t, err, sql.ErrCircuitOpen)
+	require.ErrorIs(t, err, errConnReset)
+	require.Equal(t, 4, fd.callCount())
+
+	// a successful probe closes it
+	time.Sleep(cooldown)
+	require.NoError(t, db.QueryRow(testCtx, testQuery).Scan(&val))
+	require.NoError(t, db.QueryRow(testCtx, testQuery).Scan(&val))
+	require.Equal(t, 6, fd.callCount())
+}
@@ -7,24 +7,16 @@ import (
 )
 
 var _ Driver = &SQLXDriver{}
+var _ Preparer = &SQLXDriver{}
 
-// SQLXDriver driver, implements Driver
+// SQLXDriver driver, implements Driver. Statements are run through a StdDriver over the
+// underlying database/sql pool.
 type SQLXDriver struct {
-	ctx context.Context
-	db  *sqlx.DB
+	*StdDriver
+	db *sqlx.DB
 }
 
 // NewSQLXDriverFromPool returns a new sqlx driver for Postgres
 func NewSQLXDriverFromPool(ctx context.Context, db *sqlx.DB) *SQLXDriver {
-	return &SQLXDriver{ctx: ctx, db: db}
-}
-
-// QueryRow satisfies sql.Database
-func (driver *SQLXDriver) QueryRow(_ context.Context, sql string, args ...interface{}) ScannableRow {
-	return driver.db.QueryRowx(sql, args...)
-}
-
-// Exec satisfies sql.Database
-func (driver *SQLXDriver) Exec(_ context.Context, sql string, args ...interface{}) (Result, error) {
-	return driver.db.Exec(sql, args...)
+	return &SQLXDriver{StdDriver: NewStdDriverFromPool(ctx, db.DB), db: db}
 }
@@ -0,0 +1,82 @@
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"sync"
+)
+
+var _ Driver = &StdDriver{}
+var _ Preparer = &StdDriver{}
+
+// StdDriver driver over a database/sql pool, implements Driver
+type StdDriver struct {
+	ctx context.Context
+	db  *dbsql.DB
+
+	stmts map[string]*dbsql.Stmt
+	lock  sync.RWMutex
+}
+
+// NewStdDriverFromPool returns a new database/sql driver, using any registered Postgres
+// driver such as lib/pq or pgx's stdlib
+func NewStdDriverFromPool(ctx context.Context, db *dbsql.DB) *StdDriver {
+	return &StdDriver{ctx: ctx, db: db}
+}
+
+// QueryRow satisfies sql.Database
+func (driver *StdDriver) QueryRow(ctx context.Context, sql string, args ...interface{}) ScannableRow {
+	if stmt := driver.stmt(sql); stmt != nil {
+		return stmt.QueryRowContext(ctx, args...)
+	}
+	return driver.db.QueryRowContext(ctx, sql, args...)
+}
+
+// Exec satisfies sql.Database
+func (driver *StdDriver) Exec(ctx context.Context, sql string, args ...interface{}) (Result, error) {
+	if stmt := driver.stmt(sql); stmt != nil {
+		return stmt.ExecContext(ctx, args...)
+	}
+	return driver.db.ExecContext(ctx, sql, args...)
+}
+
+// Prepare satisfies sql.Preparer. The statement is prepared once on each connection of the
+// pool, as they are used.
+func (driver *StdDriver) Prepare(ctx context.Context, sql string) error {
+	driver.lock.Lock()
+	defer driver.lock.Unlock()
+
+	if _, ok := driver.stmts[sql]; ok {
+		return nil
+	}
+	stmt, err := driver.db.PrepareContext(ctx, sql)
+	if err != nil {
+		return err
+	}
+	if driver.stmts == nil {
+		driver.stmts = make(map[string]*dbsql.Stmt)
+	}
+	driver.stmts[sql] = stmt
+	return nil
+}
+
+// Close closes the prepared statements, leaving the pool open
+func (driver *StdDriver) Close() error {
+	driver.lock.Lock()
+	defer driver.lock.Unlock()
+
+	var err error
+	for _, stmt := range driver.stmts {
+		if cerr := stmt.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	driver.stmts = nil
+	return err
+}
+
+func (driver *StdDriver) stmt(sql string) *dbsql.Stmt {
+	driver.lock.RLock()
+	defer driver.lock.RUnlock()
+	return driver.stmts[sql]
+}
@@ -0,0 +1,90 @@
+package sql
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the spans emitted by TracedDriver
+const tracerName = "github.com/cerc-io/ipld-eth-statedb/sql"
+
+var _ Driver = &TracedDriver{}
+var _ Preparer = &TracedDriver{}
+
+// TracedDriver wraps a Driver, emitting a span for each query and statement
+type TracedDriver struct {
+	driver Driver
+	tracer trace.Tracer
+}
+
+// NewTracedDriver returns a Driver tracing the calls to the given driver with the given
+// provider, or the global provider if nil
+func NewTracedDriver(driver Driver, provider trace.TracerProvider) *TracedDriver {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &TracedDriver{driver: driver, tracer: provider.Tracer(tracerName)}
+}
+
+// QueryRow satisfies sql.Database. As rows are only read once scanned, the span ends with
+// the call to Scan.
+func (driver *TracedDriver) QueryRow(ctx context.Context, sql string, args ...interface{}) ScannableRow {
+	ctx, span := driver.tracer.Start(ctx, "sql.QueryRow", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(statementAttrs(sql)...))
+	return &tracedRow{row: driver.driver.QueryRow(ctx, sql, args...), span: span}
+}
+
+// Exec satisfies sql.Database
+func (driver *TracedDriver) Exec(ctx context.Context, sql string, args ...interface{}) (Result, error) {
+	ctx, span := driver.tracer.Start(ctx, "sql.Exec", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(statementAttrs(sql)...))
+	defer span.End()
+
+	res, err := driver.driver.Exec(ctx, sql, args...)
+	if err != nil {
+		recordError(span, err)
+	}
+	return res, err
+}
+
+// Prepare satisfies sql.Preparer, preparing the statement if the wrapped driver supports it
+func (driver *TracedDriver) Prepare(ctx context.Context, sql string) error {
+	if p, ok := driver.driver.(Preparer); ok {
+		return p.Prepare(ctx, sql)
+	}
+	return nil
+}
+
+type tracedRow struct {
+	row  ScannableRow
+	span trace.Span
+}
+
+// Scan satisfies sql.ScannableRow
+func (r *tracedRow) Scan(dest ...interface{}) error {
+	defer r.span.End()
+
+	err := r.row.Scan(dest...)
+	if IsNoRows(err) {
+		r.span.SetAttributes(attribute.Bool("db.no_rows", true))
+	} else if err != nil {
+		recordError(r.span, err)
+	}
+	return err
+}
+
+func statementAttrs(sql string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.statement", sql),
+	}
+}
+
+func recordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,83 @@
+// Package blockstore provides an embedded key-value store for the CID-keyed blocks read by
+// trie_by_cid, as a local alternative to Postgres. Blocks are keyed by CID bytes exactly as
+// in ipld.blocks, so the trie_by_cid StateDB can be opened on it directly.
+package blockstore
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+
+	"github.com/cerc-io/ipld-eth-statedb/internal"
+)
+
+// Supported storage engines
+const (
+	LevelDB = "leveldb"
+	Pebble  = "pebble"
+)
+
+// Config configures an embedded blockstore
+type Config struct {
+	// Engine is the storage engine, LevelDB or Pebble. If empty, the engine of an existing
+	// database is used, or LevelDB for a new one.
+	Engine    string
+	Directory string
+	Cache     int // memory allowance for caching, in MB
+	Handles   int // number of open file handles
+	ReadOnly  bool
+}
+
+// Open opens or creates an embedded blockstore
+func Open(config Config) (ethdb.Database, error) {
+	return rawdb.Open(rawdb.OpenOptions{
+		Type:      config.Engine,
+		Directory: config.Directory,
+		Namespace: "ipld-eth-statedb/blockstore/",
+		Cache:     config.Cache,
+		Handles:   config.Handles,
+		ReadOnly:  config.ReadOnly,
+	})
+}
+
+// Put writes a block whose CID has the given codec and keccak-256 hash
+func Put(db ethdb.KeyValueWriter, codec uint64, hash common.Hash, data []byte) error {
+	cid, err := internal.Keccak256ToCid(codec, hash.Bytes())
+	if err != nil {
+		return err
+	}
+	return db.Put(cid.Bytes(), data)
+}
+
+// Copy writes all blocks of src into dst in batches, returning the number of blocks copied.
+// This can be used to load a blockstore from a CAR file, or from another local store.
+func Copy(ctx context.Context, dst ethdb.Batcher, src ethdb.Iteratee) (int, error) {
+	it := src.NewIterator(nil, nil)
+	defer it.Release()
+
+	var (
+		batch = dst.NewBatch()
+		count int
+	)
+	for it.Next() {
+		if err := batch.Put(it.Key(), it.Value()); err != nil {
+			return count, err
+		}
+		count++
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := ctx.Err(); err != nil {
+				return count, err
+			}
+			if err := batch.Write(); err != nil {
+				return count, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return count, err
+	}
+	return count, batch.Write()
+}
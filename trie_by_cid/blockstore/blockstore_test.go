@@ -0,0 +1,65 @@
+package blockstore_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethstate "github.com/ethereum/go-ethereum/core/state"
+
+	"github.com/cerc-io/ipld-eth-statedb/internal"
+	"github.com/cerc-io/ipld-eth-statedb/trie_by_cid/blockstore"
+	"github.com/cerc-io/ipld-eth-statedb/trie_by_cid/state"
+)
+
+func TestBlockstore(t *testing.T) {
+	var (
+		contract = common.HexToAddress("0x1000000000000000000000000000000000000002")
+		slot     = common.BigToHash(big.NewInt(1))
+	)
+	src, root := internal.MakeCidState(t, func(sdb *gethstate.StateDB) {
+		sdb.SetBalance(contract, big.NewInt(42))
+		sdb.SetState(contract, slot, common.BigToHash(big.NewInt(7)))
+	})
+
+	for _, engine := range []string{blockstore.LevelDB, blockstore.Pebble} {
+		t.Run(engine, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := blockstore.Open(blockstore.Config{Engine: engine, Directory: dir, Cache: 16, Handles: 16})
+			if err != nil {
+				t.Fatal(err)
+			}
+			count, err := blockstore.Copy(context.Background(), db, src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count == 0 {
+				t.Fatal("no blocks copied")
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// reopen read-only, letting the engine be detected
+			db, err = blockstore.Open(blockstore.Config{Directory: dir, Cache: 16, Handles: 16, ReadOnly: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			sdb, err := state.New(root, state.NewDatabase(db), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sdb.GetBalance(contract); got.Cmp(big.NewInt(42)) != 0 {
+				t.Fatalf("wrong balance: have %v, want 42", got)
+			}
+			if got := sdb.GetState(contract, slot); got != common.BigToHash(big.NewInt(7)) {
+				t.Fatalf("wrong storage value: have %x, want 7", got)
+			}
+			if err := sdb.Error(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+// Package car exports trie_by_cid state as CAR (Content Addressable aRchive) files, keyed
+// by the same CIDs as ipld.blocks, and serves CAR files as a read-only database.
+//
+// Only the subset of the CARv1 and CARv2 formats needed for this is implemented. Exports
+// have a single root and no CARv2 index, and any CARv2 index is ignored when reading.
+package car
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+)
+
+// CAR format versions
+const (
+	V1 uint64 = 1
+	V2 uint64 = 2
+)
+
+// carV2Pragma is the fixed prefix of a CARv2 file, a CARv1 header declaring version 2
+var carV2Pragma = [...]byte{0x0a, 0xa1, 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x02}
+
+const (
+	// size of the CARv2 header following the pragma: characteristics, data offset,
+	// data size and index offset
+	carV2HeaderSize = 16 + 3*8
+	carV2DataOffset = uint64(len(carV2Pragma) + carV2HeaderSize)
+)
+
+// carV1Header encodes the DAG-CBOR header {"roots": [root], "version": 1}
+func carV1Header(root cid.Cid) []byte {
+	// CIDs are encoded as tag 42 over a byte string, with a leading multibase identity prefix
+	link := append([]byte{0x00}, root.Bytes()...)
+
+	hdr := []byte{0xa2, 0x65, 'r', 'o', 'o', 't', 's', 0x81, 0xd8, 0x2a}
+	hdr = appendCborBytesHeader(hdr, len(link))
+	hdr = append(hdr, link...)
+	hdr = append(hdr, 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x01)
+	return hdr
+}
+
+func appendCborBytesHeader(buf []byte, n int) []byte {
+	switch {
+	case n < 24:
+		return append(buf, 0x40|byte(n))
+	case n < 1<<8:
+		return append(buf, 0x58, byte(n))
+	default:
+		return append(buf, 0x59, byte(n>>8), byte(n))
+	}
+}
+
+// blockWriter writes the sections of a CARv1 payload, counting the bytes written
+type blockWriter struct {
+	w       *bufio.Writer
+	written uint64
+	buf     [binary.MaxVarintLen64]byte
+}
+
+func newBlockWriter(w io.Writer) *blockWriter {
+	return &blockWriter{w: bufio.NewWriter(w)}
+}
+
+func (bw *blockWriter) writeSection(parts ...[]byte) error {
+	var size int
+	for _, part := range parts {
+		size += len(part)
+	}
+	n := binary.PutUvarint(bw.buf[:], uint64(size))
+	if _, err := bw.w.Write(bw.buf[:n]); err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if _, err := bw.w.Write(part); err != nil {
+			return err
+		}
+	}
+	bw.written += uint64(n + size)
+	return nil
+}
+
+func (bw *blockWriter) writeHeader(root cid.Cid) error {
+	return bw.writeSection(carV1Header(root))
+}
+
+func (bw *blockWriter) writeBlock(c cid.Cid, data []byte) error {
+	return bw.writeSection(c.Bytes(), data)
+}
+
+func (bw *blockWriter) flush() error {
+	return bw.w.Flush()
+}
+
+// writeCarV2Header writes the CARv2 pragma and header for a payload of the given size
+func writeCarV2Header(w io.Writer, dataSize uint64) error {
+	hdr := make([]byte, len(carV2Pragma)+carV2HeaderSize)
+	copy(hdr, carV2Pragma[:])
+	// characteristics are left empty, and there is no index
+	binary.LittleEndian.PutUint64(hdr[len(carV2Pragma)+16:], carV2DataOffset)
+	binary.LittleEndian.PutUint64(hdr[len(carV2Pragma)+24:], dataSize)
+	_, err := w.Write(hdr)
+	return err
+}
+
+// readCarV2Header reads the CARv2 header following the pragma, returning the offset and
+// size of the CARv1 payload
+func readCarV2Header(r io.Reader) (offset, size uint64, err error) {
+	hdr := make([]byte, carV2HeaderSize)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return 0, 0, fmt.Errorf("error reading CARv2 header: %w", err)
+	}
+	return binary.LittleEndian.Uint64(hdr[16:]), binary.LittleEndian.Uint64(hdr[24:]), nil
+}
+
+var errInvalidHeader = errors.New("invalid CAR header")
+
+// parseCarV1Header decodes the DAG-CBOR header of a CARv1 payload, returning its roots
+func parseCarV1Header(hdr []byte) ([]cid.Cid, error) {
+	d := &cborDecoder{buf: hdr}
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	if major != cborMap {
+		return nil, errInvalidHeader
+	}
+	var (
+		roots   []cid.Cid
+		version uint64
+	)
+	for i := uint64(0); i < n; i++ {
+		key, err := d.text()
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "version":
+			if major, version, err = d.head(); err != nil {
+				return nil, err
+			}
+			if major != cborUint {
+				return nil, errInvalidHeader
+			}
+		case "roots":
+			major, count, err := d.head()
+			if err != nil {
+				return nil, err
+			}
+			if major != cborArray {
+				return nil, errInvalidHeader
+			}
+			for j := uint64(0); j < count; j++ {
+				root, err := d.link()
+				if err != nil {
+					return nil, err
+				}
+				roots = append(roots, root)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unexpected key %q", errInvalidHeader, key)
+		}
+	}
+	if version != V1 {
+		return nil, fmt.Errorf("unsupported CAR version %d", version)
+	}
+	return roots, nil
+}
+
+// CBOR major types
+const (
+	cborUint  = 0
+	cborBytes = 2
+	cborText  = 3
+	cborArray = 4
+	cborMap   = 5
+	cborTag   = 6
+
+	// tag of a CID in DAG-CBOR
+	cborCidTag = 42
+)
+
+// cborDecoder decodes the few DAG-CBOR items used in CAR headers
+type cborDecoder struct {
+	buf []byte
+}
+
+// head decodes the major type and argument of the next item
+func (d *cborDecoder) head() (byte, uint64, error) {
+	if len(d.buf) == 0 {
+		return 0, 0, errInvalidHeader
+	}
+	major, info := d.buf[0]>>5, d.buf[0]&0x1f
+	d.buf = d.buf[1:]
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info <= 27:
+		size = 1 << (info - 24)
+	default:
+		return 0, 0, errInvalidHeader
+	}
+	if len(d.buf) < size {
+		return 0, 0, errInvalidHeader
+	}
+	var arg uint64
+	for _, b := range d.buf[:size] {
+		arg = arg<<8 | uint64(b)
+	}
+	d.buf = d.buf[size:]
+	return major, arg, nil
+}
+
+func (d *cborDecoder) bytes(major byte) ([]byte, error) {
+	m, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	if m != major || uint64(len(d.buf)) < n {
+		return nil, errInvalidHeader
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b, nil
+}
+
+func (d *cborDecoder) text() (string, error) {
+	b, err := d.bytes(cborText)
+	return string(b), err
+}
+
+func (d *cborDecoder) link() (cid.Cid, error) {
+	major, tag, err := d.head()
+	if err != nil {
+		return cid.Undef, err
+	}
+	if major != cborTag || tag != cborCidTag {
+		return cid.Undef, errInvalidHeader
+	}
+	b, err := d.bytes(cborBytes)
+	if err != nil {
+		return cid.Undef, err
+	}
+	// links carry a leading multibase identity prefix
+	if len(b) == 0 || b[0] != 0x00 {
+		return cid.Undef, errInvalidHeader
+	}
+	return cid.Cast(b[1:])
+}
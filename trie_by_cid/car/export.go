@@ -0,0 +1,229 @@
+package car
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cerc-io/plugeth-statediff/indexer/ipld"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/cerc-io/ipld-eth-statedb/internal"
+	"github.com/cerc-io/ipld-eth-statedb/trie_by_cid/state"
+	"github.com/cerc-io/ipld-eth-statedb/trie_by_cid/trie"
+)
+
+// ExportConfig configures a state export
+type ExportConfig struct {
+	// Version is the CAR format to write, V1 (the default) or V2. Writing V2 requires
+	// the destination to be an io.WriteSeeker.
+	Version uint64
+	// Accounts restricts the export to a subset of accounts. Only the account trie nodes
+	// proving these accounts are written, along with their full storage tries and code.
+	// If empty, the entire state is exported.
+	Accounts []common.Address
+}
+
+// Export writes all trie nodes and code reachable from the given state root to w, as a CAR
+// file whose root is the state root. Blocks are keyed by the same CIDs as in ipld.blocks.
+func Export(ctx context.Context, w io.Writer, db state.Database, root common.Hash, config ExportConfig) error {
+	var (
+		ws    io.WriteSeeker
+		start int64
+		err   error
+	)
+	switch config.Version {
+	case 0, V1:
+	case V2:
+		var ok bool
+		if ws, ok = w.(io.WriteSeeker); !ok {
+			return errors.New("CARv2 export requires an io.WriteSeeker")
+		}
+		if start, err = ws.Seek(0, io.SeekCurrent); err != nil {
+			return err
+		}
+		// the header is rewritten once the payload size is known
+		if err := writeCarV2Header(w, 0); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported CAR version %d", config.Version)
+	}
+
+	rootCid, err := internal.Keccak256ToCid(trie.StateTrieCodec, root.Bytes())
+	if err != nil {
+		return err
+	}
+	bw := newBlockWriter(w)
+	if err := bw.writeHeader(rootCid); err != nil {
+		return err
+	}
+	e := &exporter{
+		ctx:          ctx,
+		db:           db,
+		root:         root,
+		out:          bw,
+		storageRoots: make(map[common.Hash]struct{}),
+		codes:        make(map[common.Hash]struct{}),
+	}
+	if len(config.Accounts) == 0 {
+		err = e.exportState()
+	} else {
+		err = e.exportAccounts(config.Accounts)
+	}
+	if err != nil {
+		return err
+	}
+	if err := bw.flush(); err != nil {
+		return err
+	}
+
+	if ws != nil {
+		if _, err := ws.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+		if err := writeCarV2Header(w, bw.written); err != nil {
+			return err
+		}
+		if _, err := ws.Seek(start+int64(carV2DataOffset+bw.written), io.SeekStart); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type exporter struct {
+	ctx  context.Context
+	db   state.Database
+	root common.Hash
+	out  *blockWriter
+
+	// storage tries and code already written, as they are commonly shared between accounts
+	storageRoots map[common.Hash]struct{}
+	codes        map[common.Hash]struct{}
+	// account trie nodes already written, when exporting a subset of accounts
+	proofNodes map[common.Hash]struct{}
+}
+
+// exportState writes the full account trie, and every storage trie and code it references
+func (e *exporter) exportState() error {
+	tr, err := e.db.OpenTrie(e.root)
+	if err != nil {
+		return err
+	}
+	return e.exportTrie(tr, trie.StateTrieCodec, func(key, blob []byte) error {
+		var acct types.StateAccount
+		if err := rlp.DecodeBytes(blob, &acct); err != nil {
+			return fmt.Errorf("error decoding account %x: %w", key, err)
+		}
+		return e.exportAccountData(common.BytesToHash(key), &acct)
+	})
+}
+
+// exportAccounts writes the proofs of the given accounts, and their storage tries and code
+func (e *exporter) exportAccounts(addrs []common.Address) error {
+	tr, err := e.db.OpenTrie(e.root)
+	if err != nil {
+		return err
+	}
+	e.proofNodes = make(map[common.Hash]struct{})
+	for _, addr := range addrs {
+		if err := e.ctx.Err(); err != nil {
+			return err
+		}
+		addrHash := crypto.Keccak256Hash(addr.Bytes())
+		// the proof also covers accounts which don't exist
+		if err := tr.Prove(addrHash.Bytes(), 0, (*proofWriter)(e)); err != nil {
+			return fmt.Errorf("error proving account %s: %w", addr, err)
+		}
+		acct, err := tr.TryGetAccount(addr)
+		if err != nil {
+			return err
+		}
+		if acct == nil {
+			continue
+		}
+		if err := e.exportAccountData(addrHash, acct); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportAccountData writes the storage trie and code of an account
+func (e *exporter) exportAccountData(addrHash common.Hash, acct *types.StateAccount) error {
+	if _, done := e.storageRoots[acct.Root]; !done && acct.Root != types.EmptyRootHash {
+		tr, err := e.db.OpenStorageTrie(e.root, addrHash, acct.Root)
+		if err != nil {
+			return err
+		}
+		if err := e.exportTrie(tr, trie.StorageTrieCodec, nil); err != nil {
+			return fmt.Errorf("error exporting storage of account %x: %w", addrHash, err)
+		}
+		e.storageRoots[acct.Root] = struct{}{}
+	}
+	codeHash := common.BytesToHash(acct.CodeHash)
+	if _, done := e.codes[codeHash]; !done && codeHash != types.EmptyCodeHash {
+		code, err := e.db.ContractCode(codeHash)
+		if err != nil {
+			return fmt.Errorf("error loading code %s: %w", codeHash, err)
+		}
+		if err := e.writeBlock(ipld.RawBinary, codeHash, code); err != nil {
+			return err
+		}
+		e.codes[codeHash] = struct{}{}
+	}
+	return nil
+}
+
+// exportTrie writes all nodes of the trie, calling onLeaf for each leaf if it is non-nil
+func (e *exporter) exportTrie(tr state.Trie, codec uint64, onLeaf func(key, blob []byte) error) error {
+	it := tr.NodeIterator(nil)
+	for it.Next(true) {
+		if err := e.ctx.Err(); err != nil {
+			return err
+		}
+		// embedded nodes have no hash, and are written as part of their parent
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			if err := e.writeBlock(codec, hash, it.NodeBlob()); err != nil {
+				return err
+			}
+		}
+		if it.Leaf() && onLeaf != nil {
+			if err := onLeaf(it.LeafKey(), it.LeafBlob()); err != nil {
+				return err
+			}
+		}
+	}
+	return it.Error()
+}
+
+func (e *exporter) writeBlock(codec uint64, hash common.Hash, data []byte) error {
+	c, err := internal.Keccak256ToCid(codec, hash.Bytes())
+	if err != nil {
+		return err
+	}
+	return e.out.writeBlock(c, data)
+}
+
+// proofWriter receives the account trie nodes of a proof, keyed by hash
+type proofWriter exporter
+
+// Put satisfies ethdb.KeyValueWriter
+func (p *proofWriter) Put(key []byte, value []byte) error {
+	hash := common.BytesToHash(key)
+	if _, done := p.proofNodes[hash]; done {
+		return nil
+	}
+	p.proofNodes[hash] = struct{}{}
+	return (*exporter)(p).writeBlock(trie.StateTrieCodec, hash, value)
+}
+
+// Delete satisfies ethdb.KeyValueWriter
+func (p *proofWriter) Delete(key []byte) error {
+	return errors.New("not supported")
+}
@@ -0,0 +1,195 @@
+package car
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	gethstate "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+
+	"github.com/cerc-io/ipld-eth-statedb/internal"
+	"github.com/cerc-io/ipld-eth-statedb/trie_by_cid/state"
+	"github.com/cerc-io/ipld-eth-statedb/trie_by_cid/trie"
+)
+
+var (
+	testContract = common.HexToAddress("0x1000000000000000000000000000000000000002")
+	testCode     = []byte{0x60, 0x01, 0x54, 0x00}
+)
+
+func testAccount(i int64) common.Address {
+	return common.BigToAddress(big.NewInt(i + 1000))
+}
+
+func makeTestState(t *testing.T) (ethdb.Database, common.Hash) {
+	return internal.MakeCidState(t, func(sdb *gethstate.StateDB) {
+		sdb.SetCode(testContract, testCode)
+		for i := int64(0); i < 100; i++ {
+			sdb.SetState(testContract, common.BigToHash(big.NewInt(i)), common.BigToHash(big.NewInt(i+1)))
+			sdb.SetBalance(testAccount(i), big.NewInt(i+1))
+		}
+	})
+}
+
+// readTestCar reads a CARv1 payload into a CID-keyed database, checking the integrity of
+// each block, and returns the root and number of blocks
+func readTestCar(t *testing.T, r io.Reader) (cid.Cid, ethdb.Database, int) {
+	br := bufio.NewReader(r)
+	section := func() []byte {
+		size, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf
+	}
+	hdr := section()
+	if !bytes.Equal(hdr, carV1Header(mustRootCid(t, hdr))) {
+		t.Fatalf("unexpected header %x", hdr)
+	}
+	root := mustRootCid(t, hdr)
+
+	db := rawdb.NewMemoryDatabase()
+	var count int
+	for s := section(); s != nil; s = section() {
+		n, c, err := cid.CidFromBytes(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := multihash.Decode(c.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded.Digest, crypto.Keccak256(s[n:])) {
+			t.Fatalf("block %s doesn't match its CID", c)
+		}
+		if err := db.Put(c.Bytes(), s[n:]); err != nil {
+			t.Fatal(err)
+		}
+		count++
+	}
+	return root, db, count
+}
+
+// mustRootCid extracts the root from a header written by carV1Header
+func mustRootCid(t *testing.T, hdr []byte) cid.Cid {
+	start := bytes.IndexByte(hdr, 0x00)
+	if start < 0 {
+		t.Fatalf("no root in header %x", hdr)
+	}
+	_, c, err := cid.CidFromBytes(hdr[start+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestExport(t *testing.T) {
+	db, root := makeTestState(t)
+	rootCid, err := internal.Keccak256ToCid(trie.StateTrieCodec, root.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Export(context.Background(), &buf, state.NewDatabase(db), root, ExportConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	carRoot, carDB, count := readTestCar(t, &buf)
+	if !carRoot.Equals(rootCid) {
+		t.Fatalf("wrong CAR root: have %s, want %s", carRoot, rootCid)
+	}
+
+	// the exported state is complete
+	sdb, err := state.New(root, state.NewDatabase(carDB), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 100; i++ {
+		if got := sdb.GetBalance(testAccount(i)); got.Cmp(big.NewInt(i+1)) != 0 {
+			t.Fatalf("wrong balance for account %d: have %v, want %d", i, got, i+1)
+		}
+		if got := sdb.GetState(testContract, common.BigToHash(big.NewInt(i))); got != common.BigToHash(big.NewInt(i+1)) {
+			t.Fatalf("wrong value for slot %d: have %x", i, got)
+		}
+	}
+	if got := sdb.GetCode(testContract); !bytes.Equal(got, testCode) {
+		t.Fatalf("wrong code: have %x, want %x", got, testCode)
+	}
+	if err := sdb.Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a subset export holds only what is needed for the selected accounts
+	buf.Reset()
+	config := ExportConfig{Accounts: []common.Address{testContract}}
+	if err := Export(context.Background(), &buf, state.NewDatabase(db), root, config); err != nil {
+		t.Fatal(err)
+	}
+	_, subsetDB, subsetCount := readTestCar(t, &buf)
+	if subsetCount >= count {
+		t.Fatalf("expected fewer blocks in subset: have %d, full state has %d", subsetCount, count)
+	}
+	sdb, err = state.New(root, state.NewDatabase(subsetDB), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sdb.GetState(testContract, common.BigToHash(big.NewInt(5))); got != common.BigToHash(big.NewInt(6)) {
+		t.Fatalf("wrong value for slot 5: have %x", got)
+	}
+	if got := sdb.GetCode(testContract); !bytes.Equal(got, testCode) {
+		t.Fatalf("wrong code: have %x, want %x", got, testCode)
+	}
+	if err := sdb.Error(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExportV2(t *testing.T) {
+	db, root := makeTestState(t)
+	path := filepath.Join(t.TempDir(), "state.car")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Export(context.Background(), f, state.NewDatabase(db), root, ExportConfig{Version: V2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, carV2Pragma[:]) {
+		t.Fatalf("missing CARv2 pragma")
+	}
+	hdr := data[len(carV2Pragma):carV2DataOffset]
+	offset, size := binary.LittleEndian.Uint64(hdr[16:]), binary.LittleEndian.Uint64(hdr[24:])
+	if offset != carV2DataOffset || offset+size != uint64(len(data)) {
+		t.Fatalf("wrong payload bounds: offset %d, size %d, file size %d", offset, size, len(data))
+	}
+	if _, _, count := readTestCar(t, bytes.NewReader(data[offset:])); count == 0 {
+		t.Fatal("no blocks in payload")
+	}
+}
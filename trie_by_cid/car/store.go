@@ -0,0 +1,365 @@
+package car
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+// maxHeaderSize is the largest CARv1 header accepted, as in go-car
+const maxHeaderSize = 32 << 20
+
+var (
+	errReadOnly = errors.New("CAR store is read-only")
+	errNotFound = errors.New("not found")
+	errClosed   = errors.New("CAR store is closed")
+)
+
+var _ ethdb.KeyValueStore = &Store{}
+
+// Store is a read-only ethdb.KeyValueStore serving the blocks of one or more CAR files,
+// keyed by CID bytes like ipld.blocks. Blocks are indexed when the store is opened and
+// read from disk on demand.
+type Store struct {
+	files []*os.File
+	index map[string]blockLocation
+	roots []cid.Cid
+
+	// lock is held for reading across file reads, so that Close waits for them
+	lock   sync.RWMutex
+	closed bool
+}
+
+type blockLocation struct {
+	file   int
+	offset int64
+	size   int
+}
+
+// OpenDatabase opens the CAR files at the given paths as an ethdb.Database. See OpenStore.
+func OpenDatabase(paths ...string) (ethdb.Database, error) {
+	store, err := OpenStore(paths...)
+	if err != nil {
+		return nil, err
+	}
+	return rawdb.NewDatabase(store), nil
+}
+
+// OpenStore indexes the CAR files at the given paths. A path which is a directory adds
+// all files in it with a .car extension.
+func OpenStore(paths ...string) (*Store, error) {
+	s := &Store{index: make(map[string]blockLocation)}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		files := []string{path}
+		if info.IsDir() {
+			if files, err = filepath.Glob(filepath.Join(path, "*.car")); err != nil {
+				s.Close()
+				return nil, err
+			}
+		}
+		for _, file := range files {
+			if err := s.indexFile(file); err != nil {
+				s.Close()
+				return nil, fmt.Errorf("error indexing %s: %w", file, err)
+			}
+		}
+	}
+	return s, nil
+}
+
+// indexFile records the location of every block in a CARv1 or CARv2 file
+func (s *Store) indexFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	s.files = append(s.files, f)
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	start, size := int64(0), info.Size()
+
+	pragma := make([]byte, len(carV2Pragma))
+	if _, err := io.ReadFull(f, pragma); err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	if bytes.Equal(pragma, carV2Pragma[:]) {
+		offset, dataSize, err := readCarV2Header(f)
+		if err != nil {
+			return err
+		}
+		if offset > uint64(size) || dataSize > uint64(size)-offset {
+			return fmt.Errorf("CARv2 data (offset %d, size %d) exceeds file size %d", offset, dataSize, size)
+		}
+		start, size = int64(offset), int64(dataSize)
+	}
+	r := &countingReader{r: bufio.NewReader(io.NewSectionReader(f, start, size))}
+
+	hdrSize, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if hdrSize > maxHeaderSize || hdrSize > uint64(size-r.n) {
+		return fmt.Errorf("invalid header size %d", hdrSize)
+	}
+	hdr := make([]byte, hdrSize)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return err
+	}
+	roots, err := parseCarV1Header(hdr)
+	if err != nil {
+		return err
+	}
+	s.roots = append(s.roots, roots...)
+
+	for {
+		sectionSize, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		n, c, err := cid.CidFromReader(r)
+		if err != nil {
+			return err
+		}
+		if sectionSize < uint64(n) || sectionSize-uint64(n) > uint64(size-r.n) {
+			return fmt.Errorf("invalid section size %d for block %s", sectionSize, c)
+		}
+		dataSize := int(sectionSize) - n
+		s.index[string(c.Bytes())] = blockLocation{
+			file:   len(s.files) - 1,
+			offset: start + r.n,
+			size:   dataSize,
+		}
+		if err := r.discard(dataSize); err != nil {
+			return err
+		}
+	}
+}
+
+// Roots returns the state roots declared by the indexed CAR files
+func (s *Store) Roots() []common.Hash {
+	var roots []common.Hash
+	for _, root := range s.roots {
+		decoded, err := multihash.Decode(root.Hash())
+		if err != nil || decoded.Code != multihash.KECCAK_256 {
+			continue
+		}
+		roots = append(roots, common.BytesToHash(decoded.Digest))
+	}
+	return roots
+}
+
+// Has satisfies ethdb.KeyValueReader
+func (s *Store) Has(key []byte) (bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return false, errClosed
+	}
+	_, ok := s.index[string(key)]
+	return ok, nil
+}
+
+// Get satisfies ethdb.KeyValueReader
+func (s *Store) Get(key []byte) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return nil, errClosed
+	}
+	loc, ok := s.index[string(key)]
+	if !ok {
+		return nil, errNotFound
+	}
+	return s.readLocked(loc)
+}
+
+func (s *Store) read(loc blockLocation) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return nil, errClosed
+	}
+	return s.readLocked(loc)
+}
+
+// readLocked reads a block, with the lock held for reading
+func (s *Store) readLocked(loc blockLocation) ([]byte, error) {
+	data := make([]byte, loc.size)
+	if _, err := s.files[loc.file].ReadAt(data, loc.offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Put satisfies ethdb.KeyValueWriter, but always fails
+func (s *Store) Put(key []byte, value []byte) error {
+	return errReadOnly
+}
+
+// Delete satisfies ethdb.KeyValueWriter, but always fails
+func (s *Store) Delete(key []byte) error {
+	return errReadOnly
+}
+
+// Stat satisfies ethdb.Stater
+func (s *Store) Stat(property string) (string, error) {
+	return "", errors.New("unknown property")
+}
+
+// Compact satisfies ethdb.Compacter
+func (s *Store) Compact(start []byte, limit []byte) error {
+	return nil
+}
+
+// NewBatch satisfies ethdb.Batcher. Writing the batch always fails.
+func (s *Store) NewBatch() ethdb.Batch {
+	return readOnlyBatch{}
+}
+
+// NewBatchWithSize satisfies ethdb.Batcher. Writing the batch always fails.
+func (s *Store) NewBatchWithSize(int) ethdb.Batch {
+	return readOnlyBatch{}
+}
+
+// NewSnapshot satisfies ethdb.Snapshotter. The store is immutable, so it is its own snapshot.
+func (s *Store) NewSnapshot() (ethdb.Snapshot, error) {
+	return storeSnapshot{s}, nil
+}
+
+// NewIterator satisfies ethdb.Iteratee
+func (s *Store) NewIterator(prefix []byte, start []byte) ethdb.Iterator {
+	var (
+		pfx  = string(prefix)
+		from = string(append(common.CopyBytes(prefix), start...))
+		keys []string
+	)
+	for key := range s.index {
+		if strings.HasPrefix(key, pfx) && key >= from {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return &iterator{store: s, keys: keys, pos: -1}
+}
+
+// Close closes the underlying files, once reads in progress are done
+func (s *Store) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+	var err error
+	for _, f := range s.files {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	s.files = nil
+	s.closed = true
+	return err
+}
+
+type storeSnapshot struct {
+	*Store
+}
+
+// Release satisfies ethdb.Snapshot
+func (storeSnapshot) Release() {}
+
+type readOnlyBatch struct{}
+
+func (readOnlyBatch) Put([]byte, []byte) error          { return errReadOnly }
+func (readOnlyBatch) Delete([]byte) error               { return errReadOnly }
+func (readOnlyBatch) ValueSize() int                    { return 0 }
+func (readOnlyBatch) Write() error                      { return errReadOnly }
+func (readOnlyBatch) Reset()                            {}
+func (readOnlyBatch) Replay(ethdb.KeyValueWriter) error { return nil }
+
+// iterator iterates over a sorted snapshot of the store's keys
+type iterator struct {
+	store *Store
+	keys  []string
+	pos   int
+	value []byte
+	err   error
+}
+
+func (it *iterator) Next() bool {
+	if it.err != nil || it.pos+1 >= len(it.keys) {
+		it.value = nil
+		return false
+	}
+	it.pos++
+	it.value, it.err = it.store.read(it.store.index[it.keys[it.pos]])
+	return it.err == nil
+}
+
+func (it *iterator) Error() error {
+	return it.err
+}
+
+func (it *iterator) Key() []byte {
+	if it.pos < 0 || it.pos >= len(it.keys) {
+		return nil
+	}
+	return []byte(it.keys[it.pos])
+}
+
+func (it *iterator) Value() []byte {
+	return it.value
+}
+
+func (it *iterator) Release() {
+	it.keys = nil
+}
+
+// countingReader tracks the number of bytes read through it
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+func (cr *countingReader) ReadByte() (byte, error) {
+	b, err := cr.r.ReadByte()
+	if err == nil {
+		cr.n++
+	}
+	return b, err
+}
+
+func (cr *countingReader) discard(n int) error {
+	discarded, err := cr.r.Discard(n)
+	cr.n += int64(discarded)
+	return err
+}
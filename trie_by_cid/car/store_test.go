@@ -0,0 +1,159 @@
+package car
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+
+	"github.com/cerc-io/ipld-eth-statedb/trie_by_cid/state"
+)
+
+func exportFile(t *testing.T, path string, db state.Database, root common.Hash, config ExportConfig) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := Export(context.Background(), f, db, root, config); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	db, root := makeTestState(t)
+	dir := t.TempDir()
+	// split the state across a CARv1 holding the contract, and a CARv2 holding the rest
+	var others []common.Address
+	for i := int64(0); i < 100; i++ {
+		others = append(others, testAccount(i))
+	}
+	exportFile(t, filepath.Join(dir, "contract.car"), state.NewDatabase(db), root,
+		ExportConfig{Accounts: []common.Address{testContract}})
+	exportFile(t, filepath.Join(dir, "accounts.car"), state.NewDatabase(db), root,
+		ExportConfig{Version: V2, Accounts: others})
+
+	store, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if roots := store.Roots(); len(roots) != 2 || roots[0] != root || roots[1] != root {
+		t.Fatalf("wrong roots: have %v, want 2x %x", roots, root)
+	}
+
+	sdb, err := state.New(root, state.NewDatabase(rawdb.NewDatabase(store)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 100; i++ {
+		if got := sdb.GetBalance(testAccount(i)); got.Cmp(big.NewInt(i+1)) != 0 {
+			t.Fatalf("wrong balance for account %d: have %v, want %d", i, got, i+1)
+		}
+		if got := sdb.GetState(testContract, common.BigToHash(big.NewInt(i))); got != common.BigToHash(big.NewInt(i+1)) {
+			t.Fatalf("wrong value for slot %d: have %x", i, got)
+		}
+	}
+	if got := sdb.GetCode(testContract); !bytes.Equal(got, testCode) {
+		t.Fatalf("wrong code: have %x, want %x", got, testCode)
+	}
+	if err := sdb.Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	// every block can be iterated, and matches the indexed data
+	it := store.NewIterator(nil, nil)
+	defer it.Release()
+	var count int
+	for it.Next() {
+		if value, err := store.Get(it.Key()); err != nil || !bytes.Equal(value, it.Value()) {
+			t.Fatalf("iterated value doesn't match for key %x", it.Key())
+		}
+		count++
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	if count != len(store.index) {
+		t.Fatalf("wrong number of iterated blocks: have %d, want %d", count, len(store.index))
+	}
+
+	if err := store.Put([]byte{1}, []byte{1}); err != errReadOnly {
+		t.Fatalf("expected write to fail, got %v", err)
+	}
+
+	// reads fail once closed
+	key := it.Key()
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(key); err != errClosed {
+		t.Fatalf("expected read from closed store to fail, got %v", err)
+	}
+}
+
+func TestStoreCorruptHeader(t *testing.T) {
+	// a header size larger than the file
+	path := filepath.Join(t.TempDir(), "corrupt.car")
+	if err := os.WriteFile(path, []byte{0xff, 0xff, 0xff, 0xff, 0x0f, 0xa1}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenStore(path); err == nil {
+		t.Fatal("expected corrupt CAR file to fail")
+	}
+}
+
+func TestStoreConcurrentClose(t *testing.T) {
+	db, root := makeTestState(t)
+	path := filepath.Join(t.TempDir(), "state.car")
+	exportFile(t, path, state.NewDatabase(db), root, ExportConfig{Accounts: []common.Address{testContract}})
+	store, err := OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys [][]byte
+	for key := range store.index {
+		keys = append(keys, []byte(key))
+	}
+
+	// readers race with Close, and either succeed or see the store closed
+	var (
+		readers, started sync.WaitGroup
+		errs             = make(chan error, 8)
+	)
+	for i := 0; i < cap(errs); i++ {
+		readers.Add(1)
+		started.Add(1)
+		go func(i int) {
+			defer readers.Done()
+			for j := i; ; j++ {
+				_, err := store.Get(keys[j%len(keys)])
+				if j == i {
+					started.Done()
+				}
+				if err == errClosed {
+					return
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i)
+	}
+	started.Wait()
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	readers.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("unexpected read error: %v", err)
+	}
+}
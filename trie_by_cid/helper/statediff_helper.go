@@ -25,14 +25,30 @@ var (
 // - uses TestChainConfig
 // - block hash/number are left as zero
 func IndexStateDiff(dbConfig postgres.Config, stateCache state.Database, rootA, rootB common.Hash) error {
-	_, indexer, err := indexer.NewStateDiffIndexer(
-		context.Background(), ChainConfig, node.Info{}, dbConfig, true)
-	if err != nil {
-		return err
+	_, err := indexStateDiff(dbConfig, stateCache, rootA, rootB, false)
+	return err
+}
+
+// IndexStateDiffWithLeaves indexes a single statediff like IndexStateDiff, but also indexes the
+// state and storage leaves, and returns the header of the block they are indexed under.
+func IndexStateDiffWithLeaves(dbConfig postgres.Config, stateCache state.Database, rootA, rootB common.Hash) (*types.Header, error) {
+	return indexStateDiff(dbConfig, stateCache, rootA, rootB, true)
+}
+
+// IndexBlock indexes a block along with its transactions and receipts, and the statediff from
+// parentRoot to its state root, including the leaves.
+// - uses TestChainConfig
+func IndexBlock(dbConfig postgres.Config, stateCache state.Database, parentRoot common.Hash, block *types.Block, receipts types.Receipts) error {
+	args := statediff.Args{
+		OldStateRoot: parentRoot,
+		NewStateRoot: block.Root(),
+		BlockHash:    block.Hash(),
+		BlockNumber:  block.Number(),
 	}
-	defer indexer.Close() // fixme: hangs when using PGX driver
+	return pushBlock(dbConfig, stateCache, args, block, receipts, true)
+}
 
-	builder := statediff.NewBuilder(adapt.GethStateView(stateCache))
+func indexStateDiff(dbConfig postgres.Config, stateCache state.Database, rootA, rootB common.Hash, leaves bool) (*types.Header, error) {
 	block := types.NewBlock(&types.Header{Root: rootB}, nil, nil, nil, NewHasher())
 
 	// uses zero block hash/number, we only need the trie structure here
@@ -40,15 +56,37 @@ func IndexStateDiff(dbConfig postgres.Config, stateCache state.Database, rootA,
 		OldStateRoot: rootA,
 		NewStateRoot: rootB,
 	}
+	if err := pushBlock(dbConfig, stateCache, args, block, nil, leaves); err != nil {
+		return nil, err
+	}
+	return block.Header(), nil
+}
+
+func pushBlock(dbConfig postgres.Config, stateCache state.Database, args statediff.Args, block *types.Block, receipts types.Receipts, leaves bool) error {
+	_, indexer, err := indexer.NewStateDiffIndexer(
+		context.Background(), ChainConfig, node.Info{}, dbConfig, true)
+	if err != nil {
+		return err
+	}
+	defer indexer.Close() // fixme: hangs when using PGX driver
+
+	builder := statediff.NewBuilder(adapt.GethStateView(stateCache))
 	diff, err := builder.BuildStateDiffObject(args, statediff.Params{})
 	if err != nil {
 		return err
 	}
-	tx, err := indexer.PushBlock(block, nil, mockTD)
+	tx, err := indexer.PushBlock(block, receipts, mockTD)
 	if err != nil {
 		return err
 	}
-	// we don't need to index diff.Nodes since we are just interested in the trie
+	// diff.Nodes are only needed when reading the leaf tables
+	if leaves {
+		for _, leaf := range diff.Nodes {
+			if err := indexer.PushStateNode(tx, leaf, block.Hash().String()); err != nil {
+				return err
+			}
+		}
+	}
 	for _, ipld := range diff.IPLDs {
 		if err := indexer.PushIPLD(tx, ipld); err != nil {
 			return err
@@ -129,6 +129,10 @@ type Trie interface {
 	// nodes of the longest existing prefix of the key (at least the root), ending
 	// with the node that proves the absence of the key.
 	Prove(key []byte, fromLevel uint, proofDb ethdb.KeyValueWriter) error
+
+	// Witness returns the RLP-encoded blobs of all the nodes which have been resolved
+	// from the database since the trie was created or last committed.
+	Witness() [][]byte
 }
 
 // NewDatabase creates a backing store for state. The returned database is safe for
@@ -141,12 +145,16 @@ func NewDatabase(db ethdb.Database) Database {
 // NewDatabaseWithConfig creates a backing store for state. The returned database
 // is safe for concurrent use and retains a lot of collapsed RLP trie nodes in a
 // large memory cache.
+//
+// If config.HashKeyed is set, db is read as a plain hash-keyed database. If config.Verify
+// is set, code is verified against its hash along with trie nodes.
 func NewDatabaseWithConfig(db ethdb.Database, config *trie.Config) Database {
+	triedb := trie.NewDatabaseWithConfig(db, config)
 	return &cachingDB{
-		disk:          db,
+		disk:          triedb.DiskDB(),
 		codeSizeCache: lru.NewCache[common.Hash, int](codeSizeCacheSize),
 		codeCache:     lru.NewSizeConstrainedCache[common.Hash, []byte](codeCacheSize),
-		triedb:        trie.NewDatabaseWithConfig(db, config),
+		triedb:        triedb,
 	}
 }
 
@@ -210,6 +218,9 @@ func (db *cachingDB) ContractCode(codeHash common.Hash) ([]byte, error) {
 		return nil, err
 	}
 	if len(code) > 0 {
+		if err := db.triedb.VerifyBlob(cid, codeHash, code); err != nil {
+			return nil, err
+		}
 		db.codeCache.Add(codeHash, code)
 		db.codeSizeCache.Add(codeHash, len(code))
 		return code, nil
@@ -0,0 +1,105 @@
+package state
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/cerc-io/plugeth-statediff/indexer/ipld"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	gethstate "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/cerc-io/ipld-eth-statedb/internal"
+	"github.com/cerc-io/ipld-eth-statedb/trie_by_cid/trie"
+)
+
+func TestHashKeyedDatabase(t *testing.T) {
+	var (
+		contract = common.HexToAddress("0x1000000000000000000000000000000000000002")
+		slot     = common.BigToHash(big.NewInt(1))
+		code     = []byte{0x60, 0x01, 0x54, 0x00}
+	)
+	// write state to a plain hash-keyed database, as geth does
+	gethdb := rawdb.NewMemoryDatabase()
+	gethsdb, err := gethstate.New(types.EmptyRootHash, gethstate.NewDatabase(gethdb), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gethsdb.SetBalance(contract, big.NewInt(42))
+	gethsdb.SetCode(contract, code)
+	for i := int64(0); i < 100; i++ {
+		gethsdb.SetState(contract, common.BigToHash(big.NewInt(i)), common.BigToHash(big.NewInt(i+1)))
+	}
+	root, err := gethsdb.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gethsdb.Database().TrieDB().Commit(root, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// CID lookups fail on it by default
+	if _, err := New(root, NewDatabase(gethdb), nil); err == nil {
+		t.Fatal("expected hash-keyed state to be unavailable without the shim")
+	}
+
+	sdb, err := New(root, NewDatabaseWithConfig(gethdb, &trie.Config{HashKeyed: true}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sdb.GetBalance(contract); got.Cmp(big.NewInt(42)) != 0 {
+		t.Fatalf("wrong balance: have %v, want 42", got)
+	}
+	if got := sdb.GetState(contract, slot); got != common.BigToHash(big.NewInt(2)) {
+		t.Fatalf("wrong storage value: have %x, want 2", got)
+	}
+	if got := sdb.GetCode(contract); !bytes.Equal(got, code) {
+		t.Fatalf("wrong code: have %x, want %x", got, code)
+	}
+
+	// both implementations agree on the result of the same changes
+	for _, s := range []vm.StateDB{sdb, gethsdb} {
+		s.SetState(contract, slot, common.Hash{})
+		s.AddBalance(contract, big.NewInt(1))
+	}
+	if have, want := sdb.IntermediateRoot(true), gethsdb.IntermediateRoot(true); have != want {
+		t.Fatalf("root mismatch: have %x, want %x", have, want)
+	}
+	if err := sdb.Error(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyCode(t *testing.T) {
+	var (
+		contract = common.HexToAddress("0x1000000000000000000000000000000000000002")
+		code     = []byte{0x60, 0x01, 0x54, 0x00}
+	)
+	db, root := internal.MakeCidState(t, func(s *gethstate.StateDB) {
+		s.SetCode(contract, code)
+	})
+	cid, err := internal.Keccak256ToCid(ipld.RawBinary, crypto.Keccak256(code))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put(cid.Bytes(), []byte{0x00}); err != nil {
+		t.Fatal(err)
+	}
+
+	sdb, err := New(root, NewDatabaseWithConfig(db, &trie.Config{Verify: true}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sdb.GetCode(contract); got != nil {
+		t.Fatalf("expected corrupted code to be rejected, have %x", got)
+	}
+	var mismatch *trie.HashMismatchError
+	if err := sdb.Error(); !errors.As(err, &mismatch) || !mismatch.CID.Equals(cid) {
+		t.Fatalf("expected hash mismatch for %s, have %v", cid, err)
+	}
+}
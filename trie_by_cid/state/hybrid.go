@@ -0,0 +1,27 @@
+package state
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/core/types"
+
+	leaf "github.com/cerc-io/ipld-eth-statedb/direct_by_leaf"
+	"github.com/cerc-io/ipld-eth-statedb/sql"
+)
+
+// NewHybrid creates a new state as of the given header, which reads accounts and storage
+// directly from the eth.state_cids and eth.storage_cids leaf tables in db, as direct_by_leaf
+// does, but can still compute state roots. Trie nodes are only loaded from stateCache for
+// the paths to the leaves modified when hashing, so reads are close to the speed of
+// direct_by_leaf while IntermediateRoot gives the correct post-state root.
+//
+// Starting the prefetcher lets the modified paths be loaded concurrently during execution.
+func NewHybrid(ctx context.Context, db sql.Database, stateCache Database, header *types.Header) (*StateDB, error) {
+	return NewWithSnapshot(header.Root, stateCache, NewLeafSnapshot(ctx, db, header))
+}
+
+// NewHybridWithConfig is like NewHybrid, but reads the leaf tables with the statements of the
+// given configuration
+func NewHybridWithConfig(ctx context.Context, db sql.Database, stateCache Database, header *types.Header, config leaf.StatementConfig) (*StateDB, error) {
+	return NewWithSnapshot(header.Root, stateCache, NewLeafSnapshotWithConfig(ctx, db, header, config))
+}
@@ -0,0 +1,64 @@
+package state
+
+import (
+	"math/big"
+	"sync/atomic"
+	"testing"
+
+	pgipfsethdb "github.com/cerc-io/ipfs-ethdb/v5/postgres/v0"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+
+	"github.com/cerc-io/ipld-eth-statedb/internal"
+	"github.com/cerc-io/ipld-eth-statedb/sql"
+)
+
+// countingDB counts the reads made through it
+type countingDB struct {
+	ethdb.Database
+	reads atomic.Uint64
+}
+
+func (db *countingDB) Get(key []byte) ([]byte, error) {
+	db.reads.Add(1)
+	return db.Database.Get(key)
+}
+
+func TestHybrid(t *testing.T) {
+	pool, header, gethsdb := indexLeafState(t)
+	db := &countingDB{Database: pgipfsethdb.NewDatabase(pool, internal.MakeCacheConfig(t))}
+	sdb, err := NewHybrid(testCtx, sql.NewSQLXDriverFromPool(testCtx, pool), NewDatabase(db), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdb.StartPrefetcher("test")
+	defer sdb.StopPrefetcher()
+
+	// only the state root is loaded to open the state, reads don't touch any other node
+	opened := db.reads.Load()
+	if got := sdb.GetBalance(leafTestAccount); got.Cmp(big.NewInt(42)) != 0 {
+		t.Fatalf("wrong balance: have %v, want 42", got)
+	}
+	for i := int64(0); i < 10; i++ {
+		if got := sdb.GetState(leafTestContract, common.BigToHash(big.NewInt(i))); got != common.BigToHash(big.NewInt(i+1)) {
+			t.Fatalf("wrong value for slot %d: have %x", i, got)
+		}
+	}
+	if reads := db.reads.Load(); reads != opened {
+		t.Fatalf("leaf reads loaded %d trie nodes", reads-opened)
+	}
+
+	// the paths to modified leaves are loaded when hashing
+	for _, s := range []vm.StateDB{sdb, gethsdb} {
+		s.AddBalance(leafTestAccount, big.NewInt(1))
+		s.SetState(leafTestContract, common.BigToHash(big.NewInt(3)), common.Hash{})
+		s.SetState(leafTestContract, common.BigToHash(big.NewInt(20)), common.BigToHash(big.NewInt(1)))
+	}
+	if have, want := sdb.IntermediateRoot(true), gethsdb.IntermediateRoot(true); have != want {
+		t.Fatalf("root mismatch: have %x, want %x", have, want)
+	}
+	if err := sdb.Error(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,114 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	leaf "github.com/cerc-io/ipld-eth-statedb/direct_by_leaf"
+	"github.com/cerc-io/ipld-eth-statedb/sql"
+)
+
+var _ snapshot.Snapshot = &LeafSnapshot{}
+
+// LeafSnapshot implements the read side of a snapshot.Snapshot over the eth.state_cids and
+// eth.storage_cids leaf tables, as of a given canonical header. Passed to NewWithSnapshot, it
+// lets the StateDB read accounts and slots directly from the leaf tables, as direct_by_leaf
+// does, while hashing and proofs still go through the tries. The leaves are read with the
+// same statements as direct_by_leaf.
+type LeafSnapshot struct {
+	ctx    context.Context
+	db     sql.Database
+	stmts  leaf.Statements
+	root   common.Hash
+	header common.Hash
+}
+
+// NewLeafSnapshot returns a snapshot of the state at the given header, read from the default
+// ipld-eth-db schemas
+func NewLeafSnapshot(ctx context.Context, db sql.Database, header *types.Header) *LeafSnapshot {
+	return NewLeafSnapshotWithConfig(ctx, db, header, leaf.StatementConfig{})
+}
+
+// NewLeafSnapshotWithConfig returns a snapshot of the state at the given header, read with
+// the statements of the given configuration
+func NewLeafSnapshotWithConfig(ctx context.Context, db sql.Database, header *types.Header, config leaf.StatementConfig) *LeafSnapshot {
+	return &LeafSnapshot{
+		ctx:    ctx,
+		db:     db,
+		stmts:  leaf.NewStatements(config),
+		root:   header.Root,
+		header: header.Hash(),
+	}
+}
+
+// Root satisfies snapshot.Snapshot, returning the state root of the header
+func (s *LeafSnapshot) Root() common.Hash {
+	return s.root
+}
+
+// Account satisfies snapshot.Snapshot. It returns nil if the account doesn't exist at the
+// header, or was removed at or before it.
+func (s *LeafSnapshot) Account(hash common.Hash) (*snapshot.Account, error) {
+	var (
+		nonce              uint64
+		balance            string
+		codeHash, rootHash string
+		removed            bool
+	)
+	err := s.db.QueryRow(s.ctx, s.stmts.StateAccount, hash.Hex(), s.header.Hex()).
+		Scan(&balance, &nonce, &codeHash, &rootHash, &removed)
+	if sql.IsNoRows(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if removed {
+		return nil, nil
+	}
+	bal, ok := new(big.Int).SetString(balance, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid balance %q for account %x", balance, hash)
+	}
+	return &snapshot.Account{
+		Nonce:    nonce,
+		Balance:  bal,
+		Root:     common.HexToHash(rootHash).Bytes(),
+		CodeHash: common.HexToHash(codeHash).Bytes(),
+	}, nil
+}
+
+// AccountRLP satisfies snapshot.Snapshot, returning the account in the slim snapshot format
+func (s *LeafSnapshot) AccountRLP(hash common.Hash) ([]byte, error) {
+	acc, err := s.Account(hash)
+	if err != nil || acc == nil {
+		return nil, err
+	}
+	return snapshot.SlimAccountRLP(acc.Nonce, acc.Balance, common.BytesToHash(acc.Root), acc.CodeHash), nil
+}
+
+// Storage satisfies snapshot.Snapshot, returning the RLP-encoded value of the slot, or nil if
+// it's empty at the header.
+func (s *LeafSnapshot) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
+	var (
+		value                     []byte
+		removed, stateLeafRemoved bool
+	)
+	err := s.db.QueryRow(s.ctx, s.stmts.StorageSlot, accountHash.Hex(), storageHash.Hex(), s.header.Hex()).
+		Scan(&value, &removed, &stateLeafRemoved)
+	if sql.IsNoRows(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if removed || stateLeafRemoved {
+		return nil, nil
+	}
+	return value, nil
+}
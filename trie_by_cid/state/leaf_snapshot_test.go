@@ -0,0 +1,160 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	pgipfsethdb "github.com/cerc-io/ipfs-ethdb/v5/postgres/v0"
+	"github.com/cerc-io/plugeth-statediff/indexer/database/sql/postgres"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	gethstate "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/jackc/pgx/v4"
+	"github.com/jmoiron/sqlx"
+
+	leaf "github.com/cerc-io/ipld-eth-statedb/direct_by_leaf"
+	"github.com/cerc-io/ipld-eth-statedb/internal"
+	"github.com/cerc-io/ipld-eth-statedb/sql"
+	"github.com/cerc-io/ipld-eth-statedb/trie_by_cid/helper"
+)
+
+var (
+	leafTestAccount  = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	leafTestContract = common.HexToAddress("0x1000000000000000000000000000000000000002")
+	leafTestCode     = []byte{0x60, 0x01, 0x54, 0x00}
+)
+
+// indexLeafState indexes a test state, including its leaves, into Postgres. It returns the
+// connection, the header the state is indexed under, and a geth StateDB of the same state.
+func indexLeafState(t *testing.T) (*sqlx.DB, *types.Header, *gethstate.StateDB) {
+	gethdb := rawdb.NewMemoryDatabase()
+	gethsdb, err := gethstate.New(types.EmptyRootHash, gethstate.NewDatabase(gethdb), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gethsdb.SetBalance(leafTestAccount, big.NewInt(42))
+	gethsdb.SetNonce(leafTestAccount, 3)
+	gethsdb.SetCode(leafTestContract, leafTestCode)
+	for i := int64(0); i < 10; i++ {
+		gethsdb.SetState(leafTestContract, common.BigToHash(big.NewInt(i)), common.BigToHash(big.NewInt(i+1)))
+	}
+	root, err := gethsdb.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gethsdb.Database().TrieDB().Commit(root, false); err != nil {
+		t.Fatal(err)
+	}
+	if gethsdb, err = gethstate.New(root, gethsdb.Database(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := postgres.ConnectSQLX(testCtx, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, stmt := range []string{
+			`TRUNCATE eth.header_cids`,
+			`TRUNCATE eth.state_cids`,
+			`TRUNCATE eth.storage_cids`,
+			`TRUNCATE ipld.blocks`,
+		} {
+			if _, err := pool.Exec(stmt); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	header, err := helper.IndexStateDiffWithLeaves(testConfig, gethsdb.Database(), types.EmptyRootHash, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool, header, gethsdb
+}
+
+func TestLeafSnapshot(t *testing.T) {
+	var (
+		missing = common.HexToAddress("0x1000000000000000000000000000000000000003")
+		slot    = common.BigToHash(big.NewInt(1))
+	)
+	pool, header, gethsdb := indexLeafState(t)
+	snap := NewLeafSnapshot(testCtx, sql.NewSQLXDriverFromPool(testCtx, pool), header)
+
+	acc, err := snap.Account(crypto.Keccak256Hash(leafTestAccount.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc == nil || acc.Nonce != 3 || acc.Balance.Cmp(big.NewInt(42)) != 0 {
+		t.Fatalf("wrong account: %+v", acc)
+	}
+	if acc, err := snap.Account(crypto.Keccak256Hash(missing.Bytes())); err != nil || acc != nil {
+		t.Fatalf("expected missing account, have %+v (err %v)", acc, err)
+	}
+	enc, err := snap.Storage(crypto.Keccak256Hash(leafTestContract.Bytes()), crypto.Keccak256Hash(slot.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x02}; !bytes.Equal(enc, want) {
+		t.Fatalf("wrong storage value: have %x, want %x", enc, want)
+	}
+
+	// leaves are read from the snapshot, while hashing goes through the tries
+	db := pgipfsethdb.NewDatabase(pool, internal.MakeCacheConfig(t))
+	sdb, err := NewWithSnapshot(header.Root, NewDatabase(db), snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sdb.GetBalance(leafTestAccount); got.Cmp(big.NewInt(42)) != 0 {
+		t.Fatalf("wrong balance: have %v, want 42", got)
+	}
+	if got := sdb.GetCode(leafTestContract); !bytes.Equal(got, leafTestCode) {
+		t.Fatalf("wrong code: have %x, want %x", got, leafTestCode)
+	}
+	sdb.SetState(leafTestContract, slot, common.Hash{})
+	gethsdb.SetState(leafTestContract, slot, common.Hash{})
+	if have, want := sdb.IntermediateRoot(true), gethsdb.IntermediateRoot(true); have != want {
+		t.Fatalf("root mismatch: have %x, want %x", have, want)
+	}
+	if err := sdb.Error(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// queryRecorder is a sql.Driver recording the statements it's asked to run, which all return
+// no rows
+type queryRecorder struct {
+	queries []string
+}
+
+func (d *queryRecorder) QueryRow(ctx context.Context, sql string, args ...interface{}) sql.ScannableRow {
+	d.queries = append(d.queries, sql)
+	return noRows{}
+}
+
+func (d *queryRecorder) Exec(ctx context.Context, sql string, args ...interface{}) (sql.Result, error) {
+	panic("unexpected Exec")
+}
+
+type noRows struct{}
+
+func (noRows) Scan(...interface{}) error { return pgx.ErrNoRows }
+
+func TestLeafSnapshotConfig(t *testing.T) {
+	config := leaf.StatementConfig{EthSchema: "chain2_eth"}
+	db := &queryRecorder{}
+	snap := NewLeafSnapshotWithConfig(testCtx, db, &types.Header{}, config)
+	if acc, err := snap.Account(common.Hash{}); err != nil || acc != nil {
+		t.Fatalf("expected missing account, have %+v (err %v)", acc, err)
+	}
+	if enc, err := snap.Storage(common.Hash{}, common.Hash{}); err != nil || enc != nil {
+		t.Fatalf("expected empty slot, have %x (err %v)", enc, err)
+	}
+	stmts := leaf.NewStatements(config)
+	if len(db.queries) != 2 || db.queries[0] != stmts.StateAccount || db.queries[1] != stmts.StorageSlot {
+		t.Fatalf("leaves not read with the configured statements: %v", db.queries)
+	}
+}
@@ -0,0 +1,53 @@
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+)
+
+func TestRecorder(t *testing.T) {
+	var (
+		read    = common.HexToAddress("0xaaaa")
+		written = common.HexToAddress("0xbbbb")
+		key     = common.Hash{0x01}
+	)
+	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if state.Recording() != nil {
+		t.Fatal("expected no recording before the recorder is started")
+	}
+	state.StartRecorder()
+
+	state.GetBalance(read)
+	state.SetBalance(written, big.NewInt(1))
+	state.SetState(written, key, common.Hash{0x02})
+	cpy := state.Copy()
+
+	rec := state.Recording()
+	if len(rec.Accounts) != 2 {
+		t.Fatalf("expected 2 recorded accounts, got %d", len(rec.Accounts))
+	}
+	acct := rec.Accounts[read]
+	if acct == nil || acct.Pre != nil || acct.Written {
+		t.Fatalf("unexpected record for read account: %+v", acct)
+	}
+	acct = rec.Accounts[written]
+	if acct == nil || acct.Pre != nil || !acct.Written {
+		t.Fatalf("unexpected record for written account: %+v", acct)
+	}
+	slot := acct.Storage[key]
+	if slot == nil || slot.Pre != (common.Hash{}) || !slot.Written {
+		t.Fatalf("unexpected record for written slot: %+v", slot)
+	}
+
+	// the copy records independently of the original
+	cpy.GetBalance(common.HexToAddress("0xcccc"))
+	if got := len(state.Recording().Accounts); got != 2 {
+		t.Fatalf("expected 2 recorded accounts in original, got %d", got)
+	}
+	if got := len(cpy.Recording().Accounts); got != 3 {
+		t.Fatalf("expected 3 recorded accounts in copy, got %d", got)
+	}
+}
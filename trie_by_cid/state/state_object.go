@@ -121,6 +121,9 @@ func (s *stateObject) touch() {
 	s.db.journal.append(touchChange{
 		account: &s.address,
 	})
+	if s.db.recorder != nil {
+		s.db.recorder.OnAccountWrite(s.address)
+	}
 	if s.address == ripemd {
 		// Explicitly put it in the dirty-cache, which is otherwise generated from
 		// flattened journals.
@@ -217,6 +220,9 @@ func (s *stateObject) GetCommittedState(db Database, key common.Hash) common.Has
 		}
 		value.SetBytes(content)
 	}
+	if s.db.recorder != nil {
+		s.db.recorder.OnSlotLoad(s.address, key, value)
+	}
 	s.originStorage[key] = value
 	return value
 }
@@ -234,6 +240,9 @@ func (s *stateObject) SetState(db Database, key, value common.Hash) {
 		key:      key,
 		prevalue: prev,
 	})
+	if s.db.recorder != nil {
+		s.db.recorder.OnSlotWrite(s.address, key)
+	}
 	s.setState(key, value)
 }
 
@@ -375,6 +384,9 @@ func (s *stateObject) SetBalance(amount *big.Int) {
 		account: &s.address,
 		prev:    new(big.Int).Set(s.data.Balance),
 	})
+	if s.db.recorder != nil {
+		s.db.recorder.OnAccountWrite(s.address)
+	}
 	s.setBalance(amount)
 }
 
@@ -414,9 +426,12 @@ func (s *stateObject) Code(db Database) []byte {
 	if bytes.Equal(s.CodeHash(), types.EmptyCodeHash.Bytes()) {
 		return nil
 	}
+	if s.db.recorder != nil {
+		s.db.recorder.OnCodeRead(s.address)
+	}
 	code, err := db.ContractCode(common.BytesToHash(s.CodeHash()))
 	if err != nil {
-		s.db.setError(fmt.Errorf("can't load code hash %x: %v", s.CodeHash(), err))
+		s.db.setError(fmt.Errorf("can't load code hash %x: %w", s.CodeHash(), err))
 	}
 	s.code = code
 	return code
@@ -432,20 +447,29 @@ func (s *stateObject) CodeSize(db Database) int {
 	if bytes.Equal(s.CodeHash(), types.EmptyCodeHash.Bytes()) {
 		return 0
 	}
+	if s.db.recorder != nil {
+		s.db.recorder.OnCodeRead(s.address)
+	}
 	size, err := db.ContractCodeSize(common.BytesToHash(s.CodeHash()))
 	if err != nil {
-		s.db.setError(fmt.Errorf("can't load code size %x: %v", s.CodeHash(), err))
+		s.db.setError(fmt.Errorf("can't load code size %x: %w", s.CodeHash(), err))
 	}
 	return size
 }
 
 func (s *stateObject) SetCode(codeHash common.Hash, code []byte) {
 	prevcode := s.Code(s.db.db)
+	if prevcode != nil && !s.dirtyCode {
+		s.db.retiredWitness().addCode(prevcode)
+	}
 	s.db.journal.append(codeChange{
 		account:  &s.address,
 		prevhash: s.CodeHash(),
 		prevcode: prevcode,
 	})
+	if s.db.recorder != nil {
+		s.db.recorder.OnCodeWrite(s.address)
+	}
 	s.setCode(codeHash, code)
 }
 
@@ -460,6 +484,9 @@ func (s *stateObject) SetNonce(nonce uint64) {
 		account: &s.address,
 		prev:    s.data.Nonce,
 	})
+	if s.db.recorder != nil {
+		s.db.recorder.OnAccountWrite(s.address)
+	}
 	s.setNonce(nonce)
 }
 
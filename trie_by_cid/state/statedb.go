@@ -32,6 +32,7 @@ import (
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 
+	"github.com/cerc-io/ipld-eth-statedb/internal/recorder"
 	"github.com/cerc-io/ipld-eth-statedb/trie_by_cid/trie"
 )
 
@@ -108,6 +109,12 @@ type StateDB struct {
 	validRevisions []revision
 	nextRevisionId int
 
+	// Optional record of all state accessed, with its pre-values
+	recorder *AccessRecord
+
+	// Witness data loaded by tries and objects which have since been replaced
+	retired *witnessSet
+
 	// Measurements gathered during execution for debugging purposes
 	AccountReads         time.Duration
 	AccountHashes        time.Duration
@@ -155,17 +162,37 @@ func New(root common.Hash, db Database, snaps *snapshot.Tree) (*StateDB, error)
 	return sdb, nil
 }
 
+// NewWithSnapshot creates a new state from a given trie, reading accounts and storage from
+// the given snapshot layer rather than a snapshot tree, e.g. a LeafSnapshot. The snapshot
+// must be of the same root.
+func NewWithSnapshot(root common.Hash, db Database, snap snapshot.Snapshot) (*StateDB, error) {
+	if snap.Root() != root {
+		return nil, fmt.Errorf("snapshot root %x doesn't match state root %x", snap.Root(), root)
+	}
+	sdb, err := New(root, db, nil)
+	if err != nil {
+		return nil, err
+	}
+	sdb.snap = snap
+	sdb.snapAccounts = make(map[common.Hash][]byte)
+	sdb.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
+	return sdb, nil
+}
+
 // StartPrefetcher initializes a new trie prefetcher to pull in nodes from the
 // state trie concurrently while the state is mutated so that when we reach the
 // commit phase, most of the needed data is already hot.
+//
+// Unlike upstream, the prefetcher runs whether or not a snapshot is available,
+// since reads from the trie itself also benefit from nodes pulled into the clean
+// cache ahead of time. Prefetching is driven by the access lists passed to Prepare,
+// and by the accounts and slots modified in each transaction.
 func (s *StateDB) StartPrefetcher(namespace string) {
 	if s.prefetcher != nil {
 		s.prefetcher.close()
 		s.prefetcher = nil
 	}
-	if s.snap != nil {
-		s.prefetcher = newTriePrefetcher(s.db, s.originalRoot, namespace)
-	}
+	s.prefetcher = newTriePrefetcher(s.db, s.originalRoot, namespace)
 }
 
 // StopPrefetcher terminates a running prefetcher and reports any leftover stats
@@ -189,6 +216,51 @@ func (s *StateDB) Error() error {
 	return s.dbErr
 }
 
+// StartRecorder enables recording of all accounts, storage slots and code accessed through
+// the StateDB, along with their values as loaded from the snapshot or trie. Only state loaded
+// after this point is recorded, so it should be called before execution begins.
+func (s *StateDB) StartRecorder() {
+	if s.recorder == nil {
+		s.recorder = recorder.New()
+	}
+}
+
+// Recording returns a copy of the state accesses recorded so far, or nil if recording
+// is not enabled.
+func (s *StateDB) Recording() *AccessRecord {
+	if s.recorder == nil {
+		return nil
+	}
+	return s.recorder.Copy()
+}
+
+// Witness collects all trie nodes and contract code loaded from the database since the
+// StateDB was created, which are sufficient to re-run the same execution against a
+// database populated from the witness. Nodes touched while computing the state root
+// are included, so IntermediateRoot should be called beforehand if the root is needed.
+//
+// Accounts and storage served by a snapshot are not backed by trie nodes, so the
+// witness is only complete if the StateDB was created without one.
+func (s *StateDB) Witness() *Witness {
+	set := newWitnessSet()
+	if s.retired != nil {
+		set.merge(s.retired)
+	}
+	set.addStateNodes(s.trie.Witness())
+	for _, obj := range s.stateObjects {
+		set.addObject(obj)
+	}
+	return set.witness(s.originalRoot)
+}
+
+// retiredWitness returns the set of witness data from replaced tries and objects
+func (s *StateDB) retiredWitness() *witnessSet {
+	if s.retired == nil {
+		s.retired = newWitnessSet()
+	}
+	return s.retired
+}
+
 func (s *StateDB) AddLog(log *types.Log) {
 	s.journal.append(addLogChange{txhash: s.thash})
 
@@ -309,6 +381,17 @@ func (s *StateDB) GetCodeHash(addr common.Address) common.Hash {
 	return common.BytesToHash(stateObject.CodeHash())
 }
 
+// GetStorageRoot retrieves the storage root of the given account, or the empty hash
+// if the account doesn't exist. Pending storage changes are only reflected after
+// IntermediateRoot.
+func (s *StateDB) GetStorageRoot(addr common.Address) common.Hash {
+	stateObject := s.getStateObject(addr)
+	if stateObject == nil {
+		return common.Hash{}
+	}
+	return stateObject.data.Root
+}
+
 // GetState retrieves a value from the given account's storage trie.
 func (s *StateDB) GetState(addr common.Address, hash common.Hash) common.Hash {
 	stateObject := s.getStateObject(addr)
@@ -356,6 +439,16 @@ func (s *StateDB) GetCommittedState(addr common.Address, hash common.Hash) commo
 	return common.Hash{}
 }
 
+// DirtyAccounts returns the addresses of all accounts modified by the transactions
+// finalised since the state was opened.
+func (s *StateDB) DirtyAccounts() []common.Address {
+	addrs := make([]common.Address, 0, len(s.stateObjectsDirty))
+	for addr := range s.stateObjectsDirty {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
 // Database retrieves the low level database supporting the lower level trie ops.
 func (s *StateDB) Database() Database {
 	return s.db
@@ -464,6 +557,9 @@ func (s *StateDB) Suicide(addr common.Address) bool {
 	})
 	stateObject.markSuicided()
 	stateObject.data.Balance = new(big.Int)
+	if s.recorder != nil {
+		s.recorder.OnAccountWrite(addr)
+	}
 
 	return true
 }
@@ -562,6 +658,9 @@ func (s *StateDB) getDeletedStateObject(addr common.Address) *stateObject {
 		}
 		if err == nil {
 			if acc == nil {
+				if s.recorder != nil {
+					s.recorder.OnAccountLoad(addr, nil)
+				}
 				return nil
 			}
 			data = &types.StateAccount{
@@ -591,9 +690,15 @@ func (s *StateDB) getDeletedStateObject(addr common.Address) *stateObject {
 			return nil
 		}
 		if data == nil {
+			if s.recorder != nil {
+				s.recorder.OnAccountLoad(addr, nil)
+			}
 			return nil
 		}
 	}
+	if s.recorder != nil {
+		s.recorder.OnAccountLoad(addr, data)
+	}
 	// Insert into the live set
 	obj := newObject(s, addr, *data)
 	s.setStateObject(obj)
@@ -624,6 +729,7 @@ func (s *StateDB) createObject(addr common.Address) (newobj, prev *stateObject)
 		if !prevdestruct {
 			s.stateObjectsDestruct[prev.address] = struct{}{}
 		}
+		s.retiredWitness().addObject(prev)
 	}
 	newobj = newObject(s, addr, types.StateAccount{})
 	if prev == nil {
@@ -632,6 +738,9 @@ func (s *StateDB) createObject(addr common.Address) (newobj, prev *stateObject)
 		s.journal.append(resetObjectChange{prev: prev, prevdestruct: prevdestruct})
 	}
 	s.setStateObject(newobj)
+	if s.recorder != nil {
+		s.recorder.OnAccountWrite(addr)
+	}
 	if prev != nil && !prev.deleted {
 		return newobj, prev
 	}
@@ -763,13 +872,20 @@ func (s *StateDB) Copy() *StateDB {
 	state.accessList = s.accessList.Copy()
 	state.transientStorage = s.transientStorage.Copy()
 
+	if s.recorder != nil {
+		state.recorder = s.recorder.Copy()
+	}
+	if s.retired != nil {
+		state.retired = s.retired.copy()
+	}
+
 	// If there's a prefetcher running, make an inactive copy of it that can
 	// only access data but does not actively preload (since the user will not
 	// know that they need to explicitly terminate an active copy).
 	if s.prefetcher != nil {
 		state.prefetcher = s.prefetcher.copy()
 	}
-	if s.snaps != nil {
+	if s.snaps != nil || s.snap != nil {
 		// In order for the miner to be able to use and make additions
 		// to the snapshot tree, we need to copy that as well.
 		// Otherwise, any block mined by ourselves will cause gaps in the tree,
@@ -908,6 +1024,7 @@ func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
 	// which has the same root, but also has some content loaded into it.
 	if prefetcher != nil {
 		if trie := prefetcher.trie(common.Hash{}, s.originalRoot); trie != nil {
+			s.retiredWitness().addStateNodes(s.trie.Witness())
 			s.trie = trie
 		}
 	}
@@ -988,10 +1105,43 @@ func (s *StateDB) Prepare(rules params.Rules, sender, coinbase common.Address, d
 			al.AddAddress(coinbase)
 		}
 	}
+	if s.prefetcher != nil {
+		s.prefetchAccessList(sender, dst, list)
+	}
 	// Reset transient storage at the beginning of transaction execution
 	s.transientStorage = newTransientStorage()
 }
 
+// prefetchAccessList schedules the accounts and slots the transaction is expected to
+// access with the prefetcher.
+func (s *StateDB) prefetchAccessList(sender common.Address, dst *common.Address, list types.AccessList) {
+	addresses := [][]byte{common.CopyBytes(sender[:])}
+	if dst != nil {
+		addresses = append(addresses, common.CopyBytes(dst[:]))
+	}
+	for _, el := range list {
+		addresses = append(addresses, common.CopyBytes(el.Address[:]))
+	}
+	s.prefetcher.prefetch(common.Hash{}, s.originalRoot, addresses)
+
+	// Storage tries are identified by their root, so slots are only scheduled for accounts
+	// already loaded, rather than blocking on the account reads here
+	for _, el := range list {
+		if len(el.StorageKeys) == 0 {
+			continue
+		}
+		obj := s.stateObjects[el.Address]
+		if obj == nil || obj.deleted || obj.data.Root == types.EmptyRootHash {
+			continue
+		}
+		slots := make([][]byte, 0, len(el.StorageKeys))
+		for _, key := range el.StorageKeys {
+			slots = append(slots, common.CopyBytes(key[:]))
+		}
+		s.prefetcher.prefetch(obj.addrHash, obj.data.Root, slots)
+	}
+}
+
 // AddAddressToAccessList adds the given address to the access list
 func (s *StateDB) AddAddressToAccessList(addr common.Address) {
 	if s.accessList.AddAddress(addr) {
@@ -23,6 +23,11 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	gethstate "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+
+	"github.com/cerc-io/ipld-eth-statedb/internal"
 )
 
 func filledStateDB() *StateDB {
@@ -108,3 +113,63 @@ func TestCopyClose(t *testing.T) {
 		t.Fatal("Copy trie should not return nil")
 	}
 }
+
+func TestPrefetchWithoutSnapshot(t *testing.T) {
+	var (
+		sender   = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		contract = common.HexToAddress("0x1000000000000000000000000000000000000002")
+		slot     = common.BigToHash(big.NewInt(7))
+	)
+	db, root := internal.MakeCidState(t, func(s *gethstate.StateDB) {
+		s.SetBalance(sender, big.NewInt(100))
+		for i := int64(0); i < 100; i++ {
+			s.SetState(contract, common.BigToHash(big.NewInt(i)), common.BigToHash(big.NewInt(i+1)))
+		}
+	})
+	rules := params.TestChainConfig.Rules(big.NewInt(0), false, 0)
+	list := types.AccessList{{Address: contract, StorageKeys: []common.Hash{slot}}}
+	modify := func(s *StateDB) {
+		s.Prepare(rules, sender, common.Address{}, &contract, nil, list)
+		s.SetState(contract, slot, common.Hash{})
+		s.SubBalance(sender, big.NewInt(1))
+		s.Finalise(true)
+	}
+
+	sdb, err := New(root, NewDatabase(db), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdb.StartPrefetcher("test")
+	if sdb.prefetcher == nil {
+		t.Fatal("prefetcher not started without a snapshot")
+	}
+	// accounts are scheduled without being loaded
+	sdb.Prepare(rules, sender, common.Address{}, &contract, nil, list)
+	if sdb.stateObjects[contract] != nil {
+		t.Fatal("account loaded while preparing")
+	}
+	if sdb.prefetcher.fetchers[sdb.prefetcher.trieID(common.Hash{}, root)] == nil {
+		t.Fatal("account trie not scheduled for the access list")
+	}
+	// the slots of loaded accounts are scheduled too
+	sdb.GetState(contract, common.Hash{})
+	sdb.Prepare(rules, sender, common.Address{}, &contract, nil, list)
+	obj := sdb.getStateObject(contract)
+	if sdb.prefetcher.fetchers[sdb.prefetcher.trieID(obj.addrHash, obj.data.Root)] == nil {
+		t.Fatal("storage trie not scheduled for the access list")
+	}
+	modify(sdb)
+	have := sdb.IntermediateRoot(true)
+
+	ref, err := New(root, NewDatabase(db), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modify(ref)
+	if want := ref.IntermediateRoot(true); have != want {
+		t.Fatalf("root mismatch: have %x, want %x", have, want)
+	}
+	if err := sdb.Error(); err != nil {
+		t.Fatal(err)
+	}
+}
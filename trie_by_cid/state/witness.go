@@ -0,0 +1,155 @@
+package state
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/cerc-io/plugeth-statediff/indexer/ipld"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/cerc-io/ipld-eth-statedb/internal"
+	"github.com/cerc-io/ipld-eth-statedb/trie_by_cid/trie"
+)
+
+// Witness is a self-contained set of the trie nodes and contract code read while
+// executing against a StateDB. It holds everything needed to repeat the same execution
+// on top of Root without access to the original database.
+type Witness struct {
+	Root         common.Hash
+	StateNodes   [][]byte // nodes of the account trie
+	StorageNodes [][]byte // nodes of any storage trie
+	Codes        [][]byte
+}
+
+// DecodeWitness decodes a witness serialized with Witness.Encode
+func DecodeWitness(data []byte) (*Witness, error) {
+	w := new(Witness)
+	if err := rlp.DecodeBytes(data, w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Encode serializes the witness as RLP
+func (w *Witness) Encode() ([]byte, error) {
+	return rlp.EncodeToBytes(w)
+}
+
+// Populate writes the contents of the witness into db, keyed by CID in the same way as
+// ipld.blocks, so that a StateDB can be opened on it at Root.
+func (w *Witness) Populate(db ethdb.KeyValueWriter) error {
+	for _, set := range []struct {
+		codec uint64
+		blobs [][]byte
+	}{
+		{trie.StateTrieCodec, w.StateNodes},
+		{trie.StorageTrieCodec, w.StorageNodes},
+		{ipld.RawBinary, w.Codes},
+	} {
+		for _, blob := range set.blobs {
+			cid, err := internal.Keccak256ToCid(set.codec, crypto.Keccak256(blob))
+			if err != nil {
+				return err
+			}
+			if err := db.Put(cid.Bytes(), blob); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Database returns a new in-memory database holding the contents of the witness
+func (w *Witness) Database() (ethdb.Database, error) {
+	db := rawdb.NewMemoryDatabase()
+	if err := w.Populate(db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// witnessSet accumulates the deduplicated contents of a witness
+type witnessSet struct {
+	stateNodes   map[common.Hash][]byte
+	storageNodes map[common.Hash][]byte
+	codes        map[common.Hash][]byte
+}
+
+func newWitnessSet() *witnessSet {
+	return &witnessSet{
+		stateNodes:   make(map[common.Hash][]byte),
+		storageNodes: make(map[common.Hash][]byte),
+		codes:        make(map[common.Hash][]byte),
+	}
+}
+
+func (ws *witnessSet) addStateNodes(blobs [][]byte) {
+	for _, blob := range blobs {
+		ws.stateNodes[crypto.Keccak256Hash(blob)] = blob
+	}
+}
+
+func (ws *witnessSet) addStorageNodes(blobs [][]byte) {
+	for _, blob := range blobs {
+		ws.storageNodes[crypto.Keccak256Hash(blob)] = blob
+	}
+}
+
+func (ws *witnessSet) addCode(code []byte) {
+	ws.codes[crypto.Keccak256Hash(code)] = code
+}
+
+// addObject adds the storage nodes and code loaded by a state object
+func (ws *witnessSet) addObject(obj *stateObject) {
+	if obj.trie != nil {
+		ws.addStorageNodes(obj.trie.Witness())
+	}
+	if obj.code != nil && !obj.dirtyCode {
+		ws.addCode(obj.code)
+	}
+}
+
+func (ws *witnessSet) merge(other *witnessSet) {
+	for hash, blob := range other.stateNodes {
+		ws.stateNodes[hash] = blob
+	}
+	for hash, blob := range other.storageNodes {
+		ws.storageNodes[hash] = blob
+	}
+	for hash, code := range other.codes {
+		ws.codes[hash] = code
+	}
+}
+
+func (ws *witnessSet) copy() *witnessSet {
+	cpy := newWitnessSet()
+	cpy.merge(ws)
+	return cpy
+}
+
+// witness flattens the set into a Witness, sorted for a deterministic encoding
+func (ws *witnessSet) witness(root common.Hash) *Witness {
+	return &Witness{
+		Root:         root,
+		StateNodes:   sortedValues(ws.stateNodes),
+		StorageNodes: sortedValues(ws.storageNodes),
+		Codes:        sortedValues(ws.codes),
+	}
+}
+
+func sortedValues(m map[common.Hash][]byte) [][]byte {
+	hashes := make([]common.Hash, 0, len(m))
+	for hash := range m {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i][:], hashes[j][:]) < 0 })
+	values := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		values[i] = m[hash]
+	}
+	return values
+}
@@ -0,0 +1,80 @@
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethstate "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+
+	"github.com/cerc-io/ipld-eth-statedb/internal"
+)
+
+func TestWitness(t *testing.T) {
+	var (
+		sender   = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		contract = common.HexToAddress("0x1000000000000000000000000000000000000002")
+		missing  = common.HexToAddress("0x1000000000000000000000000000000000000003")
+		code     = []byte{0x60, 0x01, 0x54, 0x00}
+	)
+	db, root := internal.MakeCidState(t, func(sdb *gethstate.StateDB) {
+		sdb.SetBalance(sender, big.NewInt(100))
+		sdb.SetCode(contract, code)
+		for i := int64(0); i < 100; i++ {
+			sdb.SetState(contract, common.BigToHash(big.NewInt(i)), common.BigToHash(big.NewInt(i+1)))
+			sdb.SetBalance(common.BigToAddress(big.NewInt(i+1000)), big.NewInt(i))
+		}
+	})
+
+	// execute a few reads and writes, and return the resulting root
+	execute := func(db ethdb.Database, root common.Hash) (*StateDB, common.Hash) {
+		sdb, err := New(root, NewDatabase(db), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sdb.GetBalance(sender); got.Cmp(big.NewInt(100)) != 0 {
+			t.Fatalf("wrong balance: have %v, want 100", got)
+		}
+		if got := sdb.GetState(contract, common.BigToHash(big.NewInt(5))); got != common.BigToHash(big.NewInt(6)) {
+			t.Fatalf("wrong storage value: have %x, want 6", got)
+		}
+		if got := sdb.GetCode(contract); !bytes.Equal(got, code) {
+			t.Fatalf("wrong code: have %x, want %x", got, code)
+		}
+		sdb.SetState(contract, common.BigToHash(big.NewInt(7)), common.Hash{})
+		sdb.AddBalance(missing, big.NewInt(1))
+		sdb.SubBalance(sender, big.NewInt(1))
+		newRoot := sdb.IntermediateRoot(true)
+		if err := sdb.Error(); err != nil {
+			t.Fatal(err)
+		}
+		return sdb, newRoot
+	}
+
+	sdb, expected := execute(db, root)
+	w := sdb.Witness()
+	if w.Root != root {
+		t.Fatalf("wrong witness root: have %x, want %x", w.Root, root)
+	}
+	if len(w.Codes) != 1 {
+		t.Fatalf("expected 1 code in witness, got %d", len(w.Codes))
+	}
+	enc, err := w.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeWitness(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	witnessDB, err := decoded.Database()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same execution succeeds on the witness alone
+	if _, got := execute(witnessDB, decoded.Root); got != expected {
+		t.Fatalf("wrong root from witness: have %x, want %x", got, expected)
+	}
+}
@@ -0,0 +1,208 @@
+package trie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// defaultSubtrieDepth is the default depth of the subtries tracked by Analyze
+const defaultSubtrieDepth = 2
+
+// AnalyzeConfig configures a trie analysis
+type AnalyzeConfig struct {
+	// Start is the path, in nibbles, to resume a capped analysis from, as returned in
+	// TrieStats.Next. The analysis starts from the root if empty.
+	Start []byte
+	// MaxNodes caps the number of stored nodes visited, or is zero for no limit
+	MaxNodes uint64
+	// SubtrieDepth is the depth, in nibbles, of the subtries whose sizes are tracked; if zero,
+	// subtries two nibbles below the root are tracked.
+	SubtrieDepth int
+}
+
+// TrieStats holds the node statistics of a trie, or of the part of it covered by a capped
+// analysis. The stats of consecutive analyses of the same trie can be combined with Add.
+type TrieStats struct {
+	FullNodes   uint64
+	ShortNodes  uint64
+	ValueNodes  uint64
+	StoredNodes uint64 // nodes stored by hash, i.e. not embedded in their parent
+	Size        uint64 // total RLP size of the stored nodes
+
+	// LeafDepths holds the number of value nodes by the depth, in nibbles, of the node
+	// holding them
+	LeafDepths []uint64
+
+	// Next is the path to resume from if the analysis was capped, or nil once the whole
+	// trie has been covered
+	Next []byte
+
+	subtrieDepth int
+	subtries     map[string]*SubtrieStats
+}
+
+// SubtrieStats holds the size of the subtrie rooted at a path
+type SubtrieStats struct {
+	Path  []byte // path of the subtrie root, in nibbles
+	Nodes uint64 // number of stored nodes
+	Size  uint64 // total RLP size of the stored nodes
+}
+
+// Analyze walks the trie and collects statistics on its nodes. Stored nodes are decoded to
+// also account for the nodes embedded in them. If config.MaxNodes is reached, the walk stops
+// and TrieStats.Next is set to the path to resume from.
+func Analyze(ctx context.Context, tr *Trie, config AnalyzeConfig) (*TrieStats, error) {
+	if len(config.Start)%2 != 0 {
+		return nil, fmt.Errorf("can't resume from path of odd length %x", config.Start)
+	}
+	depth := config.SubtrieDepth
+	if depth == 0 {
+		depth = defaultSubtrieDepth
+	}
+	stats := &TrieStats{subtrieDepth: depth, subtries: make(map[string]*SubtrieStats)}
+
+	var start []byte
+	if len(config.Start) > 0 {
+		start = hexToKeyBytes(config.Start)
+	}
+	it := tr.NodeIterator(start)
+	for it.Next(true) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		// embedded and value nodes are accounted for when decoding their parents
+		hash := it.Hash()
+		if hash == (common.Hash{}) {
+			continue
+		}
+		path := it.Path()
+		// only stop at even paths, which can be resumed from by key
+		if config.MaxNodes > 0 && stats.StoredNodes >= config.MaxNodes && len(path)%2 == 0 {
+			stats.Next = common.CopyBytes(path)
+			return stats, nil
+		}
+		blob := it.NodeBlob()
+		if blob == nil {
+			err := it.Error()
+			if err == nil {
+				err = &MissingNodeError{Owner: tr.owner, NodeHash: hash, Path: path}
+			}
+			return nil, fmt.Errorf("failed to load node at path %x: %w", path, err)
+		}
+		n, err := decodeNode(hash.Bytes(), blob)
+		if err != nil {
+			return nil, err
+		}
+		stats.StoredNodes++
+		stats.Size += uint64(len(blob))
+		if len(path) >= depth {
+			key := string(path[:depth])
+			sub := stats.subtries[key]
+			if sub == nil {
+				sub = &SubtrieStats{Path: common.CopyBytes(path[:depth])}
+				stats.subtries[key] = sub
+			}
+			sub.Nodes++
+			sub.Size += uint64(len(blob))
+		}
+		stats.addNode(n, path)
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// addNode counts a decoded node and the nodes embedded in it
+func (s *TrieStats) addNode(n node, path []byte) {
+	switch n := n.(type) {
+	case *fullNode:
+		s.FullNodes++
+		for i, child := range &n.Children {
+			if child == nil {
+				continue
+			}
+			if i == 16 {
+				s.addLeaf(len(path))
+				continue
+			}
+			if _, ok := child.(hashNode); !ok {
+				s.addNode(child, concat(path, byte(i)))
+			}
+		}
+	case *shortNode:
+		s.ShortNodes++
+		switch n.Val.(type) {
+		case valueNode:
+			s.addLeaf(len(path))
+		case hashNode:
+			// stored nodes are visited by the iterator
+		default:
+			s.addNode(n.Val, concat(path, n.Key...))
+		}
+	}
+}
+
+func (s *TrieStats) addLeaf(depth int) {
+	s.ValueNodes++
+	for len(s.LeafDepths) <= depth {
+		s.LeafDepths = append(s.LeafDepths, 0)
+	}
+	s.LeafDepths[depth]++
+}
+
+// MaxDepth returns the depth, in nibbles, of the deepest value node, or -1 if there are none
+func (s *TrieStats) MaxDepth() int {
+	return len(s.LeafDepths) - 1
+}
+
+// Largest returns the n largest subtries by size, rooted at the configured subtrie depth
+func (s *TrieStats) Largest(n int) []SubtrieStats {
+	all := make([]SubtrieStats, 0, len(s.subtries))
+	for _, sub := range s.subtries {
+		all = append(all, *sub)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Size != all[j].Size {
+			return all[i].Size > all[j].Size
+		}
+		return string(all[i].Path) < string(all[j].Path)
+	})
+	if n < len(all) {
+		all = all[:n]
+	}
+	return all
+}
+
+// Add combines the stats of the analysis which resumed from this one
+func (s *TrieStats) Add(next *TrieStats) error {
+	if s.subtrieDepth != next.subtrieDepth {
+		return errors.New("can't combine stats of different subtrie depths")
+	}
+	s.FullNodes += next.FullNodes
+	s.ShortNodes += next.ShortNodes
+	s.ValueNodes += next.ValueNodes
+	s.StoredNodes += next.StoredNodes
+	s.Size += next.Size
+	for depth, count := range next.LeafDepths {
+		for len(s.LeafDepths) <= depth {
+			s.LeafDepths = append(s.LeafDepths, 0)
+		}
+		s.LeafDepths[depth] += count
+	}
+	for key, sub := range next.subtries {
+		if cur := s.subtries[key]; cur != nil {
+			cur.Nodes += sub.Nodes
+			cur.Size += sub.Size
+		} else {
+			cpy := *sub
+			s.subtries[key] = &cpy
+		}
+	}
+	s.Next = next.Next
+	return nil
+}
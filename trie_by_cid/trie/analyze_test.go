@@ -0,0 +1,94 @@
+package trie
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+)
+
+func TestAnalyze(t *testing.T) {
+	_, trie, content := makeTestTrie(t)
+	tr := &trie.trie
+
+	var size uint64
+	nodes := forHashedNodes(tr)
+	for _, blob := range nodes {
+		size += uint64(len(blob))
+	}
+	full, err := Analyze(context.Background(), tr, AnalyzeConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.Next != nil {
+		t.Fatalf("uncapped analysis should be complete, have next path %x", full.Next)
+	}
+	if full.ValueNodes != uint64(len(content)) {
+		t.Fatalf("wrong number of value nodes: have %d, want %d", full.ValueNodes, len(content))
+	}
+	if full.StoredNodes != uint64(len(nodes)) || full.Size != size {
+		t.Fatalf("wrong stored nodes: have %d (%d bytes), want %d (%d bytes)", full.StoredNodes, full.Size, len(nodes), size)
+	}
+	var leaves uint64
+	for _, count := range full.LeafDepths {
+		leaves += count
+	}
+	if leaves != full.ValueNodes {
+		t.Fatalf("leaf depths add up to %d, want %d", leaves, full.ValueNodes)
+	}
+	largest := full.Largest(3)
+	if len(largest) != 3 || largest[0].Size < largest[1].Size || largest[1].Size < largest[2].Size {
+		t.Fatalf("largest subtries not sorted by size: %v", largest)
+	}
+
+	// a capped analysis resumed until completion gives the same result
+	capped, err := Analyze(context.Background(), tr, AnalyzeConfig{MaxNodes: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := 1
+	for capped.Next != nil {
+		next, err := Analyze(context.Background(), tr, AnalyzeConfig{Start: capped.Next, MaxNodes: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := capped.Add(next); err != nil {
+			t.Fatal(err)
+		}
+		runs++
+	}
+	if runs < 2 {
+		t.Fatal("analysis was not capped")
+	}
+	if capped.FullNodes != full.FullNodes || capped.ShortNodes != full.ShortNodes ||
+		capped.ValueNodes != full.ValueNodes || capped.StoredNodes != full.StoredNodes || capped.Size != full.Size {
+		t.Fatalf("resumed stats differ: have %+v, want %+v", capped, full)
+	}
+	if capped.MaxDepth() != full.MaxDepth() {
+		t.Fatalf("wrong max depth: have %d, want %d", capped.MaxDepth(), full.MaxDepth())
+	}
+	for i, sub := range capped.Largest(3) {
+		if sub.Size != largest[i].Size || sub.Nodes != largest[i].Nodes {
+			t.Fatalf("wrong subtrie %d: have %v, want %v", i, sub, largest[i])
+		}
+	}
+}
+
+func TestAnalyzeMissingNode(t *testing.T) {
+	// the nodes of an uncommitted trie can't be loaded from the database
+	tr := NewEmpty(NewDatabase(rawdb.NewMemoryDatabase()))
+	for i := byte(0); i < 32; i++ {
+		tr.Update([]byte{i, 1}, []byte{i})
+	}
+	tr.Hash()
+
+	_, err := Analyze(context.Background(), tr, AnalyzeConfig{})
+	var missing *MissingNodeError
+	if !errors.As(err, &missing) {
+		t.Fatalf("expected missing node error, have %v", err)
+	}
+	if len(missing.Path) != 0 {
+		t.Fatalf("wrong path of missing node: %x", missing.Path)
+	}
+}
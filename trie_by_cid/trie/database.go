@@ -20,6 +20,7 @@ import (
 	"errors"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/fastcache"
@@ -29,7 +30,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/rlp"
-	"github.com/ethereum/go-ethereum/trie"
+	gethtrie "github.com/ethereum/go-ethereum/trie"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -60,13 +61,53 @@ type Database struct {
 	dirtiesSize  common.StorageSize // Storage size of the dirty node cache (exc. metadata)
 	childrenSize common.StorageSize // Storage size of the external children tracking
 	preimages    *preimageStore     // The store for caching preimages
+	index        NodeIndex          // Index to diagnose missing nodes, if any
+	resolver     NodeResolver       // Fallback source of missing nodes, if any
+	writeBack    bool               // Whether to persist nodes obtained from the resolver
+	verify       bool               // Whether to verify the hashes of blobs loaded from disk
+	mismatches   atomic.Uint64      // Number of blobs rejected by verification
+	nodeStats    nodeCounters       // Counts of node retrievals, for tracing
 
 	lock sync.RWMutex
 }
 
-// Config defines all necessary options for database.
-// (re-export)
-type Config = trie.Config
+// Config defines all necessary options for database. It was an alias of go-ethereum's
+// trie.Config, whose fields it keeps; use FromGethConfig to convert one.
+type Config struct {
+	Cache     int    // Memory allowance (MB) to use for caching trie nodes in memory
+	Journal   string // Journal of clean cache to survive node restarts
+	Preimages bool   // Flag whether the preimage of trie key is recorded
+
+	// HashKeyed indicates the disk database keys trie nodes and code by plain hash, like
+	// geth's hash-scheme chaindata, rather than by CID.
+	HashKeyed bool
+
+	// Index, if set, is consulted for nodes which can't be found by hash, so that missing
+	// nodes indexed in node metadata are reported with a diagnosis. It doesn't resolve them.
+	Index NodeIndex
+
+	// Resolver, if set, is consulted for nodes missing from the disk database. Resolved nodes
+	// are verified against their hash, cached, and written to the disk database if WriteBack
+	// is set. It must be safe for concurrent use.
+	Resolver  NodeResolver
+	WriteBack bool
+
+	// Verify enables verification of the hashes of trie nodes and code loaded from the disk
+	// database, rejecting corrupted blobs with a HashMismatchError.
+	Verify bool
+}
+
+// FromGethConfig returns the Config with the options of a go-ethereum trie.Config
+func FromGethConfig(config *gethtrie.Config) *Config {
+	if config == nil {
+		return nil
+	}
+	return &Config{
+		Cache:     config.Cache,
+		Journal:   config.Journal,
+		Preimages: config.Preimages,
+	}
+}
 
 // NewDatabase creates a new trie database to store ephemeral trie content before
 // its written out to disk or garbage collected. No read cache is created, so all
@@ -87,6 +128,9 @@ func NewDatabaseWithConfig(diskdb ethdb.Database, config *Config) *Database {
 			cleans = fastcache.LoadFromFileOrNew(config.Journal, config.Cache*1024*1024)
 		}
 	}
+	if config != nil && config.HashKeyed {
+		diskdb = newHashKeyedDB(diskdb)
+	}
 	var preimage *preimageStore
 	if config != nil && config.Preimages {
 		preimage = newPreimageStore(diskdb)
@@ -99,9 +143,21 @@ func NewDatabaseWithConfig(diskdb ethdb.Database, config *Config) *Database {
 		}},
 		preimages: preimage,
 	}
+	if config != nil {
+		db.index = config.Index
+		db.resolver = config.Resolver
+		db.writeBack = config.WriteBack
+		db.verify = config.Verify
+	}
 	return db
 }
 
+// DiskDB retrieves the persistent storage backing the trie database. If the database
+// is configured as hash-keyed, this is the CID-keyed view of it.
+func (db *Database) DiskDB() ethdb.KeyValueStore {
+	return db.diskdb
+}
+
 // insert inserts a simplified trie node into the memory database.
 // All nodes inserted by this function will be reference tracked
 // and in theory should only used for **trie nodes** insertion.
@@ -137,6 +193,12 @@ func (db *Database) insert(hash common.Hash, size int, node node) {
 // Node retrieves an encoded cached trie node from memory. If it cannot be found
 // cached, the method queries the persistent database for the content.
 func (db *Database) Node(hash common.Hash, codec uint64) ([]byte, error) {
+	blob, err := db.node(hash, codec)
+	db.nodeStats.count(len(blob), err)
+	return blob, err
+}
+
+func (db *Database) node(hash common.Hash, codec uint64) ([]byte, error) {
 	// It doesn't make sense to retrieve the metaroot
 	if hash == (common.Hash{}) {
 		return nil, errors.New("not found")
@@ -146,6 +208,7 @@ func (db *Database) Node(hash common.Hash, codec uint64) ([]byte, error) {
 		if enc := db.cleans.Get(nil, hash[:]); enc != nil {
 			memcacheCleanHitMeter.Mark(1)
 			memcacheCleanReadMeter.Mark(int64(len(enc)))
+			db.nodeStats.hits.Add(1)
 			return enc, nil
 		}
 	}
@@ -157,6 +220,7 @@ func (db *Database) Node(hash common.Hash, codec uint64) ([]byte, error) {
 	if dirty != nil {
 		memcacheDirtyHitMeter.Mark(1)
 		memcacheDirtyReadMeter.Mark(int64(dirty.size))
+		db.nodeStats.hits.Add(1)
 		return dirty.rlp(), nil
 	}
 	memcacheDirtyMissMeter.Mark(1)
@@ -171,6 +235,9 @@ func (db *Database) Node(hash common.Hash, codec uint64) ([]byte, error) {
 		return nil, err
 	}
 	if len(enc) != 0 {
+		if err := db.VerifyBlob(cid, hash, enc); err != nil {
+			return nil, err
+		}
 		if db.cleans != nil {
 			db.cleans.Set(hash[:], enc)
 			memcacheCleanMissMeter.Mark(1)
@@ -371,13 +438,14 @@ func (db *Database) Size() (common.StorageSize, common.StorageSize) {
 
 // GetReader retrieves a node reader belonging to the given state root.
 func (db *Database) GetReader(root common.Hash, codec uint64) Reader {
-	return &hashReader{db: db, codec: codec}
+	return &hashReader{db: db, codec: codec, index: db.index}
 }
 
 // hashReader is reader of hashDatabase which implements the Reader interface.
 type hashReader struct {
 	db    *Database
 	codec uint64
+	index NodeIndex
 }
 
 // Node retrieves the trie node with the given node hash.
@@ -389,9 +457,20 @@ func (reader *hashReader) Node(owner common.Hash, path []byte, hash common.Hash)
 	return decodeNodeUnsafe(hash[:], blob)
 }
 
-// NodeBlob retrieves the RLP-encoded trie node blob with the given node hash.
-func (reader *hashReader) NodeBlob(_ common.Hash, _ []byte, hash common.Hash) ([]byte, error) {
-	return reader.db.Node(hash, reader.codec)
+// NodeBlob retrieves the RLP-encoded trie node blob with the given node hash. If the node
+// is missing, it's requested from the resolver if one is configured, then if an index is
+// configured, the node is looked up in it to diagnose why it's missing.
+func (reader *hashReader) NodeBlob(owner common.Hash, path []byte, hash common.Hash) ([]byte, error) {
+	blob, err := reader.db.Node(hash, reader.codec)
+	if err != nil && reader.db.resolver != nil {
+		if blob := reader.db.resolveNode(owner, path, hash, reader.codec); blob != nil {
+			return blob, nil
+		}
+	}
+	if err != nil && reader.index != nil {
+		return nil, diagnoseNode(reader.index, owner, path, hash, err)
+	}
+	return blob, err
 }
 
 // saveCache saves clean state cache to given directory path
@@ -21,6 +21,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	gethtrie "github.com/ethereum/go-ethereum/trie"
 )
 
 // Tests that the trie database returns a missing trie node error if attempting
@@ -31,3 +32,13 @@ func TestDatabaseMetarootFetch(t *testing.T) {
 		t.Fatalf("metaroot retrieval succeeded")
 	}
 }
+
+func TestFromGethConfig(t *testing.T) {
+	config := FromGethConfig(&gethtrie.Config{Cache: 16, Journal: "journal", Preimages: true})
+	if config.Cache != 16 || config.Journal != "journal" || !config.Preimages {
+		t.Fatalf("wrong config: %+v", config)
+	}
+	if FromGethConfig(nil) != nil {
+		t.Fatal("expected nil config")
+	}
+}
@@ -0,0 +1,115 @@
+package trie
+
+import (
+	"errors"
+
+	"github.com/cerc-io/plugeth-statediff/indexer/ipld"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+// hashKeyedDB adapts a database keyed by plain hashes, such as geth chaindata using the
+// hash scheme, to the CID-keyed reads made by this package and the state package. CID keys
+// are translated to the hash of their multihash, or to the code key for raw binary CIDs, for
+// reads, writes, deletes and batches alike. Other keys are passed through unchanged, and
+// iterators yield the keys of the underlying database.
+type hashKeyedDB struct {
+	ethdb.Database
+}
+
+func newHashKeyedDB(db ethdb.Database) *hashKeyedDB {
+	if hdb, ok := db.(*hashKeyedDB); ok {
+		return hdb
+	}
+	return &hashKeyedDB{db}
+}
+
+// Has satisfies ethdb.KeyValueReader
+func (db *hashKeyedDB) Has(key []byte) (bool, error) {
+	if codec, hash, ok := decodeKeccakCid(key); ok {
+		if codec == ipld.RawBinary {
+			return rawdb.HasCode(db.Database, hash), nil
+		}
+		return db.Database.Has(hash.Bytes())
+	}
+	return db.Database.Has(key)
+}
+
+// Get satisfies ethdb.KeyValueReader
+func (db *hashKeyedDB) Get(key []byte) ([]byte, error) {
+	if codec, hash, ok := decodeKeccakCid(key); ok {
+		if codec == ipld.RawBinary {
+			// also handles code stored under the legacy plain hash key
+			if code := rawdb.ReadCode(db.Database, hash); len(code) > 0 {
+				return code, nil
+			}
+			return nil, errors.New("not found")
+		}
+		return db.Database.Get(hash.Bytes())
+	}
+	return db.Database.Get(key)
+}
+
+// Put satisfies ethdb.KeyValueWriter
+func (db *hashKeyedDB) Put(key []byte, value []byte) error {
+	return db.Database.Put(hashKey(key), value)
+}
+
+// Delete satisfies ethdb.KeyValueWriter
+func (db *hashKeyedDB) Delete(key []byte) error {
+	return db.Database.Delete(hashKey(key))
+}
+
+// NewBatch satisfies ethdb.Batcher
+func (db *hashKeyedDB) NewBatch() ethdb.Batch {
+	return hashKeyedBatch{db.Database.NewBatch()}
+}
+
+// NewBatchWithSize satisfies ethdb.Batcher
+func (db *hashKeyedDB) NewBatchWithSize(size int) ethdb.Batch {
+	return hashKeyedBatch{db.Database.NewBatchWithSize(size)}
+}
+
+// hashKeyedBatch translates the keys written to a batch of the hash-keyed database
+type hashKeyedBatch struct {
+	ethdb.Batch
+}
+
+// Put satisfies ethdb.KeyValueWriter
+func (b hashKeyedBatch) Put(key []byte, value []byte) error {
+	return b.Batch.Put(hashKey(key), value)
+}
+
+// Delete satisfies ethdb.KeyValueWriter
+func (b hashKeyedBatch) Delete(key []byte) error {
+	return b.Batch.Delete(hashKey(key))
+}
+
+// hashKey returns the key under which the hash-keyed database stores a key. Trie node CIDs
+// map to the plain hash, and raw binary CIDs to the code key.
+func hashKey(key []byte) []byte {
+	codec, hash, ok := decodeKeccakCid(key)
+	if !ok {
+		return key
+	}
+	if codec == ipld.RawBinary {
+		return append(common.CopyBytes(rawdb.CodePrefix), hash.Bytes()...)
+	}
+	return hash.Bytes()
+}
+
+// decodeKeccakCid returns the codec and hash of a key which is a keccak-256 CID
+func decodeKeccakCid(key []byte) (uint64, common.Hash, bool) {
+	c, err := cid.Cast(key)
+	if err != nil {
+		return 0, common.Hash{}, false
+	}
+	decoded, err := multihash.Decode(c.Hash())
+	if err != nil || decoded.Code != multihash.KECCAK_256 || len(decoded.Digest) != common.HashLength {
+		return 0, common.Hash{}, false
+	}
+	return c.Type(), common.BytesToHash(decoded.Digest), true
+}
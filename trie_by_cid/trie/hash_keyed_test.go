@@ -0,0 +1,64 @@
+package trie
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cerc-io/plugeth-statediff/indexer/ipld"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/cerc-io/ipld-eth-statedb/internal"
+)
+
+func TestHashKeyedWrites(t *testing.T) {
+	var (
+		node, code = []byte{0x01}, []byte{0x60, 0x00}
+		nodeHash   = crypto.Keccak256Hash(node)
+		codeHash   = crypto.Keccak256Hash(code)
+	)
+	nodeCid, err := internal.Keccak256ToCid(ipld.MEthStateTrie, nodeHash.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	codeCid, err := internal.Keccak256ToCid(ipld.RawBinary, codeHash.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	diskdb := rawdb.NewMemoryDatabase()
+	db := newHashKeyedDB(diskdb)
+
+	// batched writes land under the same keys as direct ones
+	batch := db.NewBatch()
+	if err := batch.Put(nodeCid.Bytes(), node); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Put(codeCid.Bytes(), code); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if blob, _ := diskdb.Get(nodeHash.Bytes()); !bytes.Equal(blob, node) {
+		t.Fatalf("node not written under its hash: have %x", blob)
+	}
+	if blob := rawdb.ReadCode(diskdb, codeHash); !bytes.Equal(blob, code) {
+		t.Fatalf("code not written under its code key: have %x", blob)
+	}
+
+	if err := db.Delete(nodeCid.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	batch = db.NewBatchWithSize(0)
+	if err := batch.Delete(codeCid.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range [][]byte{nodeCid.Bytes(), codeCid.Bytes()} {
+		if has, err := db.Has(key); err != nil || has {
+			t.Fatalf("expected %x to be deleted (err %v)", key, err)
+		}
+	}
+}
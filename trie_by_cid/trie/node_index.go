@@ -0,0 +1,122 @@
+package trie
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/cerc-io/ipld-eth-statedb/internal"
+	"github.com/cerc-io/ipld-eth-statedb/sql"
+)
+
+// NodeIndex locates trie nodes in indexed node metadata, to diagnose nodes which can't be
+// found by hash
+type NodeIndex interface {
+	// LocateNode returns the latest node indexed with the given hash below the path in the
+	// trie of the owner, or the state trie if the owner is zero. It returns nil if there is
+	// none.
+	LocateNode(owner common.Hash, path []byte, hash common.Hash) (*IndexedNode, error)
+}
+
+// IndexedNode describes a node found in a NodeIndex
+type IndexedNode struct {
+	Hash        common.Hash
+	Path        []byte // hex-encoded path of the node, or key of the leaf
+	BlockNumber uint64 // block at which the node was indexed
+}
+
+// NodeResolutionError describes a node which couldn't be found by hash, based on what is
+// indexed for it. It is wrapped by the MissingNodeError returned by the trie.
+type NodeResolutionError struct {
+	Owner   common.Hash
+	Path    []byte
+	Hash    common.Hash
+	Indexed *IndexedNode // latest node indexed with the hash, if any
+	err     error        // error of the lookup by hash
+}
+
+// Unwrap returns the error of the lookup by hash
+func (e *NodeResolutionError) Unwrap() error {
+	return e.err
+}
+
+func (e *NodeResolutionError) Error() string {
+	if idx := e.Indexed; idx != nil {
+		return fmt.Sprintf("node %x is indexed at %x, block %d, but its block is missing: %v",
+			e.Hash, idx.Path, idx.BlockNumber, e.err)
+	}
+	return fmt.Sprintf("node %x not found at path %x, and isn't indexed: %v", e.Hash, e.Path, e.err)
+}
+
+// BlockMissing reports whether the node itself is indexed, but its block can't be found
+func (e *NodeResolutionError) BlockMissing() bool {
+	return e.Indexed != nil
+}
+
+// diagnoseNode looks up the path of a node which couldn't be found by hash
+func diagnoseNode(index NodeIndex, owner common.Hash, path []byte, hash common.Hash, err error) error {
+	if hasTerm(path) {
+		path = path[:len(path)-1]
+	}
+	indexed, lerr := index.LocateNode(owner, path, hash)
+	if lerr != nil {
+		return fmt.Errorf("%w (node index lookup failed: %v)", err, lerr)
+	}
+	return &NodeResolutionError{Owner: owner, Path: path, Hash: hash, Indexed: indexed, err: err}
+}
+
+var _ NodeIndex = &SQLNodeIndex{}
+
+// SQLNodeIndex is a NodeIndex over the leaf nodes indexed in the eth.state_cids and
+// eth.storage_cids tables, as of a canonical header. Only leaves are indexed there, by CID
+// and key, so intermediate nodes are never located, and a leaf is located by its hash
+// rather than its path.
+type SQLNodeIndex struct {
+	ctx    context.Context
+	db     sql.Database
+	header common.Hash
+}
+
+// NewSQLNodeIndex returns a NodeIndex of the state at the given header
+func NewSQLNodeIndex(ctx context.Context, db sql.Database, header common.Hash) *SQLNodeIndex {
+	return &SQLNodeIndex{ctx: ctx, db: db, header: header}
+}
+
+// LocateNode satisfies NodeIndex
+func (idx *SQLNodeIndex) LocateNode(owner common.Hash, path []byte, hash common.Hash) (*IndexedNode, error) {
+	var row sql.ScannableRow
+	if owner == (common.Hash{}) {
+		c, err := internal.Keccak256ToCid(StateTrieCodec, hash.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		row = idx.db.QueryRow(idx.ctx, LocateStateLeafPgStr, c.String(), idx.header.Hex())
+	} else {
+		c, err := internal.Keccak256ToCid(StorageTrieCodec, hash.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		row = idx.db.QueryRow(idx.ctx, LocateStorageLeafPgStr, owner.Hex(), c.String(), idx.header.Hex())
+	}
+	var (
+		leafKey string
+		node    = IndexedNode{Hash: hash}
+	)
+	err := row.Scan(&leafKey, &node.BlockNumber)
+	if sql.IsNoRows(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	node.Path = keybytesToHex(common.HexToHash(leafKey).Bytes())
+	node.Path = node.Path[:len(node.Path)-1]
+	// the same leaf node may be found under another path, if the remainder of its key is
+	// the same
+	if !bytes.HasPrefix(node.Path, path) {
+		return nil, nil
+	}
+	return &node, nil
+}
@@ -0,0 +1,127 @@
+package trie
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/jackc/pgx/v4"
+
+	"github.com/cerc-io/ipld-eth-statedb/internal"
+	"github.com/cerc-io/ipld-eth-statedb/sql"
+)
+
+type testNodeIndex struct {
+	node  *IndexedNode
+	owner common.Hash
+	path  []byte
+	hash  common.Hash
+}
+
+func (idx *testNodeIndex) LocateNode(owner common.Hash, path []byte, hash common.Hash) (*IndexedNode, error) {
+	idx.owner, idx.path, idx.hash = owner, path, hash
+	return idx.node, nil
+}
+
+func TestNodeIndexDiagnosis(t *testing.T) {
+	var (
+		owner = common.HexToHash("0x01")
+		hash  = common.HexToHash("0x02")
+		path  = []byte{1, 2, 3}
+	)
+	for _, tt := range []struct {
+		name    string
+		indexed *IndexedNode
+	}{
+		{"unindexed", nil},
+		{"block missing", &IndexedNode{Hash: hash, Path: append(path, 4), BlockNumber: 1}},
+	} {
+		index := &testNodeIndex{node: tt.indexed}
+		db := NewDatabaseWithConfig(rawdb.NewMemoryDatabase(), &Config{Index: index})
+		reader := &trieReader{owner: owner, reader: db.GetReader(common.Hash{}, StorageTrieCodec)}
+
+		_, err := reader.node(path, hash)
+		var missing *MissingNodeError
+		if !errors.As(err, &missing) {
+			t.Fatalf("%s: expected missing node error, have %v", tt.name, err)
+		}
+		var diag *NodeResolutionError
+		if !errors.As(err, &diag) {
+			t.Fatalf("%s: expected node resolution error, have %v", tt.name, err)
+		}
+		if index.owner != owner || !bytes.Equal(index.path, path) || index.hash != hash {
+			t.Fatalf("%s: wrong lookup: have %x/%x/%x, want %x/%x/%x", tt.name,
+				index.owner, index.path, index.hash, owner, path, hash)
+		}
+		if diag.Indexed != tt.indexed || diag.BlockMissing() != (tt.indexed != nil) {
+			t.Fatalf("%s: wrong diagnosis: %v", tt.name, diag)
+		}
+	}
+}
+
+// leafRow is a sql.Driver answering every query with the same leaf, or no rows if the key
+// is empty, and recording the arguments of the last query
+type leafRow struct {
+	key   string
+	block uint64
+	args  []interface{}
+}
+
+func (d *leafRow) QueryRow(ctx context.Context, sql string, args ...interface{}) sql.ScannableRow {
+	d.args = args
+	return d
+}
+
+func (d *leafRow) Exec(ctx context.Context, sql string, args ...interface{}) (sql.Result, error) {
+	panic("unexpected Exec")
+}
+
+func (d *leafRow) Scan(dest ...interface{}) error {
+	if d.key == "" {
+		return pgx.ErrNoRows
+	}
+	*dest[0].(*string), *dest[1].(*uint64) = d.key, d.block
+	return nil
+}
+
+func TestSQLNodeIndex(t *testing.T) {
+	var (
+		owner  = common.HexToHash("0x01")
+		hash   = common.HexToHash("0x02")
+		key    = common.HexToHash("0xab00000000000000000000000000000000000000000000000000000000000000")
+		header = common.HexToHash("0x03")
+	)
+	db := &leafRow{key: key.Hex(), block: 5}
+	index := NewSQLNodeIndex(context.Background(), db, header)
+
+	// leaves are looked up by CID, and located if their key is under the path
+	node, err := index.LocateNode(owner, []byte{0xa}, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node == nil || node.Hash != hash || node.BlockNumber != 5 ||
+		!bytes.Equal(node.Path, keybytesToHex(key.Bytes())[:2*common.HashLength]) {
+		t.Fatalf("wrong node: %+v", node)
+	}
+	c, err := internal.Keccak256ToCid(StorageTrieCodec, hash.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.args) != 3 || db.args[0] != owner.Hex() || db.args[1] != c.String() || db.args[2] != header.Hex() {
+		t.Fatalf("wrong query arguments: %v", db.args)
+	}
+
+	if node, err := index.LocateNode(owner, []byte{0xb}, hash); err != nil || node != nil {
+		t.Fatalf("expected no node under another path, have %+v (err %v)", node, err)
+	}
+	db.key = ""
+	if node, err := index.LocateNode(common.Hash{}, nil, hash); err != nil || node != nil {
+		t.Fatalf("expected no node, have %+v (err %v)", node, err)
+	}
+	if c, _ := internal.Keccak256ToCid(StateTrieCodec, hash.Bytes()); len(db.args) != 2 || db.args[0] != c.String() {
+		t.Fatalf("wrong query arguments: %v", db.args)
+	}
+}
@@ -0,0 +1,58 @@
+package trie
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NodeStats counts the node retrievals from a Database
+type NodeStats struct {
+	Reads     uint64 // nodes requested
+	CacheHits uint64 // nodes found in the clean or dirty cache
+	Failures  uint64 // nodes which couldn't be retrieved
+	Bytes     uint64 // size of the nodes retrieved
+}
+
+// nodeCounters accumulates NodeStats
+type nodeCounters struct {
+	reads, hits, failures, bytes atomic.Uint64
+}
+
+func (c *nodeCounters) count(size int, err error) {
+	c.reads.Add(1)
+	if err != nil {
+		c.failures.Add(1)
+		return
+	}
+	c.bytes.Add(uint64(size))
+}
+
+// NodeStats returns the counts of node retrievals from the database since it was created
+func (db *Database) NodeStats() NodeStats {
+	return NodeStats{
+		Reads:     db.nodeStats.reads.Load(),
+		CacheHits: db.nodeStats.hits.Load(),
+		Failures:  db.nodeStats.failures.Load(),
+		Bytes:     db.nodeStats.bytes.Load(),
+	}
+}
+
+// TraceNodes counts the node retrievals from the database until the returned function is
+// called, and sets the counts as attributes of the span in ctx. Node retrieval carries no
+// context, so retrievals made concurrently by other users of the database are counted too.
+func (db *Database) TraceNodes(ctx context.Context) (end func()) {
+	span := trace.SpanFromContext(ctx)
+	start := db.NodeStats()
+	return func() {
+		stats := db.NodeStats()
+		span.SetAttributes(
+			attribute.Int64("trie.node_reads", int64(stats.Reads-start.Reads)),
+			attribute.Int64("trie.node_cache_hits", int64(stats.CacheHits-start.CacheHits)),
+			attribute.Int64("trie.node_failures", int64(stats.Failures-start.Failures)),
+			attribute.Int64("trie.node_bytes", int64(stats.Bytes-start.Bytes)),
+		)
+	}
+}
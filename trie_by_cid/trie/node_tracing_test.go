@@ -0,0 +1,57 @@
+package trie
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceNodes(t *testing.T) {
+	cidDB, _, root, _ := makeResolverSources(t)
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	db := NewDatabaseWithConfig(rawdb.NewDatabase(cidDB), &Config{Cache: 16})
+
+	// retrievals before the span aren't counted on it
+	if _, err := db.Node(root, StateTrieCodec); err != nil {
+		t.Fatal(err)
+	}
+	ctx, span := provider.Tracer("test").Start(context.Background(), "parent")
+	end := db.TraceNodes(ctx)
+	blob, err := db.Node(root, StateTrieCodec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Node(common.Hash{0x01}, StateTrieCodec); err == nil {
+		t.Fatal("expected missing node")
+	}
+	end()
+	span.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("wrong number of spans: have %d, want 1", len(spans))
+	}
+	attrs := make(map[attribute.Key]int64)
+	for _, kv := range spans[0].Attributes {
+		attrs[kv.Key] = kv.Value.AsInt64()
+	}
+	for key, want := range map[attribute.Key]int64{
+		"trie.node_reads":      2,
+		"trie.node_cache_hits": 1,
+		"trie.node_failures":   1,
+		"trie.node_bytes":      int64(len(blob)),
+	} {
+		if attrs[key] != want {
+			t.Errorf("wrong %s: have %d, want %d", key, attrs[key], want)
+		}
+	}
+	if stats := db.NodeStats(); stats.Reads != 3 || stats.CacheHits != 1 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
@@ -0,0 +1,78 @@
+package trie
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rpc"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cerc-io/ipld-eth-statedb/internal"
+)
+
+// rpcResolveTimeout is the timeout of a node request made by an RPC resolver
+var rpcResolveTimeout = 10 * time.Second
+
+// resolveNode requests a missing node from the resolver, and verifies, caches and optionally
+// persists it. It returns nil if the node can't be resolved.
+func (db *Database) resolveNode(owner common.Hash, path []byte, hash common.Hash, codec uint64) []byte {
+	blob := db.resolver(owner, path, hash)
+	if len(blob) == 0 {
+		return nil
+	}
+	if have := crypto.Keccak256Hash(blob); have != hash {
+		log.Warn("Discarding resolved trie node with wrong hash", "owner", owner, "path", path, "hash", hash, "have", have)
+		return nil
+	}
+	if db.cleans != nil {
+		db.cleans.Set(hash[:], blob)
+	}
+	if db.writeBack {
+		cid, err := internal.Keccak256ToCid(codec, hash[:])
+		if err != nil {
+			log.Warn("Failed to persist resolved trie node", "hash", hash, "err", err)
+			return blob
+		}
+		if err := db.diskdb.Put(cid.Bytes(), blob); err != nil {
+			log.Warn("Failed to persist resolved trie node", "hash", hash, "err", err)
+		}
+	}
+	return blob
+}
+
+// NewKeyValueResolver returns a NodeResolver reading nodes from a secondary CID-keyed store,
+// such as a blockstore or a CAR archive
+func NewKeyValueResolver(db ethdb.KeyValueReader) NodeResolver {
+	return func(owner common.Hash, path []byte, hash common.Hash) []byte {
+		codec := StateTrieCodec
+		if owner != (common.Hash{}) {
+			codec = StorageTrieCodec
+		}
+		cid, err := internal.Keccak256ToCid(codec, hash[:])
+		if err != nil {
+			return nil
+		}
+		blob, _ := db.Get(cid.Bytes())
+		return blob
+	}
+}
+
+// NewRPCResolver returns a NodeResolver requesting nodes by hash through the debug_dbGet
+// method of a node using the hash scheme, such as geth
+func NewRPCResolver(client *rpc.Client) NodeResolver {
+	return func(owner common.Hash, path []byte, hash common.Hash) []byte {
+		ctx, cancel := context.WithTimeout(context.Background(), rpcResolveTimeout)
+		defer cancel()
+
+		var blob hexutil.Bytes
+		if err := client.CallContext(ctx, &blob, "debug_dbGet", hash.Hex()); err != nil {
+			log.Debug("Failed to resolve trie node", "hash", hash, "err", err)
+			return nil
+		}
+		return blob
+	}
+}
@@ -0,0 +1,101 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/cerc-io/ipld-eth-statedb/internal"
+)
+
+// debugAPI stands in for the debug_dbGet method of a hash-scheme node
+type debugAPI struct {
+	db ethdb.KeyValueReader
+}
+
+func (api *debugAPI) DbGet(key string) (hexutil.Bytes, error) {
+	return api.db.Get(common.FromHex(key))
+}
+
+// makeResolverSources returns the nodes of a test trie in CID-keyed and hash-keyed stores
+func makeResolverSources(t *testing.T) (*memorydb.Database, *memorydb.Database, common.Hash, map[string][]byte) {
+	_, trie, content := makeTestTrie(t)
+	cidDB, hashDB := memorydb.New(), memorydb.New()
+	for _, blob := range forHashedNodes(&trie.trie) {
+		hash := crypto.Keccak256(blob)
+		cid, err := internal.Keccak256ToCid(StateTrieCodec, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cidDB.Put(cid.Bytes(), blob)
+		hashDB.Put(hash, blob)
+	}
+	return cidDB, hashDB, trie.Hash(), content
+}
+
+func checkResolvedTrie(t *testing.T, db *Database, root common.Hash, content map[string][]byte) {
+	tr, err := NewStateTrie(TrieID(root), db, StateTrieCodec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range content {
+		have, err := tr.TryGet([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Fatalf("wrong value for %x: have %x, want %x", key, have, want)
+		}
+	}
+}
+
+func TestKeyValueResolver(t *testing.T) {
+	source, _, root, content := makeResolverSources(t)
+	diskdb := memorydb.New()
+	db := NewDatabaseWithConfig(rawdb.NewDatabase(diskdb), &Config{Resolver: NewKeyValueResolver(source), WriteBack: true})
+	checkResolvedTrie(t, db, root, content)
+
+	// resolved nodes were written back, so are found without the resolver
+	if have, want := diskdb.Len(), source.Len(); have != want {
+		t.Fatalf("wrong number of written nodes: have %d, want %d", have, want)
+	}
+	checkResolvedTrie(t, NewDatabase(rawdb.NewDatabase(diskdb)), root, content)
+}
+
+func TestRPCResolver(t *testing.T) {
+	_, source, root, content := makeResolverSources(t)
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("debug", &debugAPI{source}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	diskdb := memorydb.New()
+	checkResolvedTrie(t, NewDatabaseWithConfig(rawdb.NewDatabase(diskdb), &Config{Resolver: NewRPCResolver(client)}), root, content)
+	if diskdb.Len() != 0 {
+		t.Fatal("resolved nodes written without write-back")
+	}
+}
+
+func TestResolverHashMismatch(t *testing.T) {
+	_, _, root, _ := makeResolverSources(t)
+	corrupt := func(owner common.Hash, path []byte, hash common.Hash) []byte {
+		return []byte{0xc0}
+	}
+	db := NewDatabaseWithConfig(rawdb.NewMemoryDatabase(), &Config{Resolver: corrupt, WriteBack: true})
+	_, err := NewStateTrie(TrieID(root), db, StateTrieCodec)
+	var missing *MissingNodeError
+	if !errors.As(err, &missing) {
+		t.Fatalf("expected missing node error, have %v", err)
+	}
+}
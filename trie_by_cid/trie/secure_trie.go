@@ -218,6 +218,12 @@ func (t *StateTrie) Hash() common.Hash {
 	return t.trie.Hash()
 }
 
+// Witness returns the RLP-encoded blobs of all the nodes which have been resolved
+// from the database since the trie was created or last committed.
+func (t *StateTrie) Witness() [][]byte {
+	return t.trie.Witness()
+}
+
 // Copy returns a copy of StateTrie.
 func (t *StateTrie) Copy() *StateTrie {
 	return &StateTrie{
@@ -0,0 +1,29 @@
+package trie
+
+const (
+	LocateStateLeafPgStr = `SELECT state_leaf_key, state_cids.block_number FROM eth.state_cids
+						INNER JOIN eth.header_cids ON (
+							state_cids.header_id = header_cids.block_hash
+							AND state_cids.block_number = header_cids.block_number
+						)
+						WHERE state_cids.cid = $1
+						AND header_cids.block_number <= (SELECT block_number
+															FROM eth.header_cids
+															WHERE block_hash = $2)
+						AND header_cids.canonical
+						ORDER BY header_cids.block_number DESC
+						LIMIT 1`
+	LocateStorageLeafPgStr = `SELECT storage_leaf_key, storage_cids.block_number FROM eth.storage_cids
+						INNER JOIN eth.header_cids ON (
+							storage_cids.header_id = header_cids.block_hash
+							AND storage_cids.block_number = header_cids.block_number
+						)
+						WHERE state_leaf_key = $1
+						AND storage_cids.cid = $2
+						AND header_cids.block_number <= (SELECT block_number
+															FROM eth.header_cids
+															WHERE block_hash = $3)
+						AND header_cids.canonical
+						ORDER BY header_cids.block_number DESC
+						LIMIT 1`
+)
@@ -538,6 +538,17 @@ func (t *Trie) resolveAndTrack(n hashNode, prefix []byte) (node, error) {
 	return mustDecodeNode(n, blob), nil
 }
 
+// Witness returns the RLP-encoded blobs of all the nodes which have been resolved
+// from the database since the trie was created or last committed. Together they are
+// sufficient to repeat the same accesses without the database.
+func (t *Trie) Witness() [][]byte {
+	blobs := make([][]byte, 0, len(t.tracer.accessList))
+	for _, blob := range t.tracer.accessList {
+		blobs = append(blobs, common.CopyBytes(blob))
+	}
+	return blobs
+}
+
 // Hash returns the root hash of the trie. It does not write to the
 // database and can be used even if the trie doesn't have one.
 func (t *Trie) Hash() common.Hash {
@@ -0,0 +1,41 @@
+package trie
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ipfs/go-cid"
+	log "github.com/sirupsen/logrus"
+)
+
+// HashMismatchError is returned when verification is enabled and a blob loaded from the disk
+// database doesn't hash to the CID it's keyed by
+type HashMismatchError struct {
+	CID      cid.Cid
+	Observed common.Hash // keccak-256 hash of the loaded blob
+}
+
+func (e *HashMismatchError) Error() string {
+	return fmt.Sprintf("hash mismatch for block %s: have %x", e.CID, e.Observed)
+}
+
+// VerifyBlob checks that a blob loaded by the CID of the given hash hashes to it, if
+// verification is enabled. Mismatches are counted and returned as a HashMismatchError.
+func (db *Database) VerifyBlob(c cid.Cid, hash common.Hash, blob []byte) error {
+	if !db.verify {
+		return nil
+	}
+	if have := crypto.Keccak256Hash(blob); have != hash {
+		db.mismatches.Add(1)
+		hashMismatchMeter.Mark(1)
+		log.Error("Rejecting corrupted block", "cid", c, "have", have)
+		return &HashMismatchError{CID: c, Observed: have}
+	}
+	return nil
+}
+
+// Mismatches returns the number of blobs rejected by verification
+func (db *Database) Mismatches() uint64 {
+	return db.mismatches.Load()
+}
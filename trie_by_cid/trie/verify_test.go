@@ -0,0 +1,45 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/cerc-io/ipld-eth-statedb/internal"
+)
+
+func TestVerifyNodes(t *testing.T) {
+	cidDB, _, root, _ := makeResolverSources(t)
+	// corrupt the root node
+	cid, err := internal.Keccak256ToCid(StateTrieCodec, root.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := []byte{0xc0}
+	cidDB.Put(cid.Bytes(), corrupt)
+
+	// without verification the corrupted blob is returned
+	blob, err := NewDatabase(rawdb.NewDatabase(cidDB)).Node(root, StateTrieCodec)
+	if err != nil || !bytes.Equal(blob, corrupt) {
+		t.Fatalf("expected corrupted blob, have %x (err %v)", blob, err)
+	}
+
+	db := NewDatabaseWithConfig(rawdb.NewDatabase(cidDB), &Config{Cache: 16, Verify: true})
+	for i := 0; i < 2; i++ {
+		_, err := NewStateTrie(TrieID(root), db, StateTrieCodec)
+		var mismatch *HashMismatchError
+		if !errors.As(err, &mismatch) {
+			t.Fatalf("expected hash mismatch, have %v", err)
+		}
+		if !mismatch.CID.Equals(cid) || mismatch.Observed != crypto.Keccak256Hash(corrupt) {
+			t.Fatalf("wrong mismatch: have %s/%x", mismatch.CID, mismatch.Observed)
+		}
+	}
+	// rejected blobs are not cached
+	if have := db.Mismatches(); have != 2 {
+		t.Fatalf("wrong number of mismatches: have %d, want 2", have)
+	}
+}
@@ -0,0 +1,281 @@
+package trie
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// defaultWalkDepth is the default depth of the subtries walked concurrently
+	defaultWalkDepth = 2
+	// walkBufferSize is the number of nodes buffered for each subtrie being walked
+	walkBufferSize = 1024
+)
+
+// ErrDirtyWalk is returned by Walk for a trie with uncommitted changes; callers must Commit
+// the trie and reopen it at the new root before walking it.
+var ErrDirtyWalk = errors.New("can't walk a trie with uncommitted changes")
+
+// WalkConfig configures a parallel trie walk
+type WalkConfig struct {
+	// Workers is the number of subtries walked concurrently, or GOMAXPROCS if zero
+	Workers int
+	// Depth is the depth, in nibbles, at which the trie is partitioned into the subtries
+	// walked concurrently; if zero, the trie is split two nibbles below the root.
+	Depth int
+	// Unordered emits the nodes as soon as they are walked, rather than in the order of a
+	// NodeIterator.
+	Unordered bool
+}
+
+// WalkNode is a node visited by Walk
+type WalkNode struct {
+	Path []byte      // hex-encoded path to the node
+	Hash common.Hash // hash of the node, or zero if it's embedded in its parent
+	Blob []byte      // RLP encoding of the node, or nil if it's embedded in its parent
+
+	// Leaf is set for value nodes, along with the key and value of the leaf
+	Leaf     bool
+	LeafKey  []byte
+	LeafBlob []byte
+}
+
+// Walk visits all nodes of the trie, as stored in the database, by walking the subtries
+// below config.Depth concurrently. Nodes are passed to fn in the same order as by a
+// NodeIterator, or in any order if config.Unordered is set, but fn is never called
+// concurrently.
+//
+// Nodes missing from the database don't stop the walk: the subtries below them are skipped,
+// and the errors are returned in the order of their paths.
+//
+// Nodes are read from the database, so the trie must not have uncommitted changes: Walk
+// returns ErrDirtyWalk for a dirty trie, which must be committed first.
+func Walk(ctx context.Context, tr *Trie, config WalkConfig, fn func(*WalkNode) error) ([]*MissingNodeError, error) {
+	if tr.dirty() {
+		return nil, ErrDirtyWalk
+	}
+	root := tr.Hash()
+	if root == types.EmptyRootHash {
+		return nil, nil
+	}
+	workers := config.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	depth := config.Depth
+	if depth == 0 {
+		depth = defaultWalkDepth
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := &walker{ctx: ctx, reader: tr.reader}
+
+	// walk the top of the trie, collecting the subtries to be walked concurrently
+	var segments []*walkSegment
+	emitTop := func(n *WalkNode) error {
+		segments = append(segments, &walkSegment{node: n})
+		return nil
+	}
+	split := func(path []byte, hash hashNode) error {
+		segments = append(segments, &walkSegment{
+			path: path,
+			hash: hash,
+			out:  make(chan *WalkNode, walkBufferSize),
+		})
+		return nil
+	}
+	if err := w.walk(hashNode(root.Bytes()), nil, depth, emitTop, split); err != nil {
+		return nil, err
+	}
+
+	var (
+		jobs   = make(chan *walkSegment)
+		shared = make(chan *WalkNode, walkBufferSize)
+		wg     sync.WaitGroup
+
+		errOnce sync.Once
+		werr    error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			werr = err
+			cancel()
+		})
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				out := job.out
+				if config.Unordered {
+					out = shared
+				}
+				emit := func(n *WalkNode) error {
+					select {
+					case out <- n:
+						return nil
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				}
+				if err := w.walk(job.hash, job.path, -1, emit, nil); err != nil {
+					fail(err)
+				}
+				close(job.out)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, seg := range segments {
+			if seg.out == nil {
+				continue
+			}
+			select {
+			case jobs <- seg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(shared)
+	}()
+
+	// emit the nodes from this goroutine only
+	drain := func(ch chan *WalkNode) error {
+		for {
+			select {
+			case n, ok := <-ch:
+				if !ok {
+					return nil
+				}
+				if err := fn(n); err != nil {
+					return err
+				}
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	emit := func() error {
+		for _, seg := range segments {
+			if seg.node != nil {
+				if err := fn(seg.node); err != nil {
+					return err
+				}
+			} else if !config.Unordered {
+				if err := drain(seg.out); err != nil {
+					return err
+				}
+			}
+		}
+		if config.Unordered {
+			return drain(shared)
+		}
+		return nil
+	}
+	if err := emit(); err != nil {
+		fail(err)
+	}
+	cancel()
+	wg.Wait()
+	if werr != nil {
+		return nil, werr
+	}
+	gaps := w.gaps
+	sort.Slice(gaps, func(i, j int) bool {
+		return bytes.Compare(gaps[i].Path, gaps[j].Path) < 0
+	})
+	return gaps, nil
+}
+
+// dirty reports whether the trie has changes which are not committed to the database
+func (t *Trie) dirty() bool {
+	switch n := t.root.(type) {
+	case *fullNode:
+		return n.flags.dirty
+	case *shortNode:
+		return n.flags.dirty
+	}
+	return false
+}
+
+// walkSegment is either a node at the top of the trie, or a subtrie walked concurrently
+type walkSegment struct {
+	node *WalkNode
+
+	path []byte
+	hash hashNode
+	out  chan *WalkNode
+}
+
+// walker walks subtries, recording missing nodes. The trie reader is shared by the workers,
+// which is safe as nodes are only read.
+type walker struct {
+	ctx    context.Context
+	reader *trieReader
+
+	lock sync.Mutex
+	gaps []*MissingNodeError
+}
+
+// walk visits the subtrie rooted at n in pre-order. Stored nodes at or below depth are
+// passed to split rather than walked, unless depth is negative.
+func (w *walker) walk(n node, path []byte, depth int, emit func(*WalkNode) error, split func([]byte, hashNode) error) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	item := &WalkNode{Path: path}
+	switch nn := n.(type) {
+	case hashNode:
+		if depth >= 0 && len(path) >= depth {
+			return split(path, nn)
+		}
+		hash := common.BytesToHash(nn)
+		blob, err := w.reader.nodeBlob(path, hash)
+		if err != nil {
+			var missing *MissingNodeError
+			if !errors.As(err, &missing) {
+				return err
+			}
+			w.lock.Lock()
+			w.gaps = append(w.gaps, missing)
+			w.lock.Unlock()
+			return nil
+		}
+		if n, err = decodeNode(nn, blob); err != nil {
+			return err
+		}
+		item.Hash, item.Blob = hash, blob
+	case valueNode:
+		return emit(&WalkNode{Path: path, Leaf: true, LeafKey: hexToKeyBytes(path), LeafBlob: nn})
+	}
+	if err := emit(item); err != nil {
+		return err
+	}
+	switch nn := n.(type) {
+	case *fullNode:
+		for i, child := range &nn.Children {
+			if child == nil {
+				continue
+			}
+			if err := w.walk(child, concat(path, byte(i)), depth, emit, split); err != nil {
+				return err
+			}
+		}
+	case *shortNode:
+		return w.walk(nn.Val, concat(path, nn.Key...), depth, emit, split)
+	}
+	return nil
+}
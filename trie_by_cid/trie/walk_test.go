@@ -0,0 +1,130 @@
+package trie
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+)
+
+// iterateNodes returns the nodes of the trie as visited by a NodeIterator
+func iterateNodes(tr *Trie) []string {
+	var nodes []string
+	it := tr.NodeIterator(nil)
+	for it.Next(true) {
+		nodes = append(nodes, fmt.Sprintf("%x:%x:%v", it.Path(), it.Hash(), it.Leaf()))
+	}
+	return nodes
+}
+
+func walkNodes(t *testing.T, tr *Trie, config WalkConfig) ([]string, []*MissingNodeError) {
+	var nodes []string
+	gaps, err := Walk(context.Background(), tr, config, func(n *WalkNode) error {
+		nodes = append(nodes, fmt.Sprintf("%x:%x:%v", n.Path, n.Hash, n.Leaf))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nodes, gaps
+}
+
+func TestWalk(t *testing.T) {
+	_, trie, _ := makeTestTrie(t)
+	tr := &trie.trie
+	want := iterateNodes(tr)
+
+	// nodes are walked in iterator order
+	have, gaps := walkNodes(t, tr, WalkConfig{Workers: 4})
+	if len(gaps) != 0 {
+		t.Fatalf("unexpected gaps: %v", gaps)
+	}
+	if len(have) != len(want) {
+		t.Fatalf("wrong number of nodes: have %d, want %d", len(have), len(want))
+	}
+	for i := range want {
+		if have[i] != want[i] {
+			t.Fatalf("node %d mismatch: have %s, want %s", i, have[i], want[i])
+		}
+	}
+
+	// or in any order, at any depth
+	for _, depth := range []int{1, 3} {
+		have, _ := walkNodes(t, tr, WalkConfig{Workers: 4, Depth: depth, Unordered: true})
+		seen := make(map[string]bool)
+		for _, n := range have {
+			seen[n] = true
+		}
+		if len(have) != len(want) || len(seen) != len(want) {
+			t.Fatalf("depth %d: wrong number of nodes: have %d, want %d", depth, len(have), len(want))
+		}
+		for _, n := range want {
+			if !seen[n] {
+				t.Fatalf("depth %d: node %s not walked", depth, n)
+			}
+		}
+	}
+}
+
+func TestWalkMissingNode(t *testing.T) {
+	_, trie, _ := makeTestTrie(t)
+	tr := &trie.trie
+
+	// remove a node above the partition depth, and one below it in another subtrie
+	var missing [][]byte
+	nodes := forHashedNodes(tr)
+	for path := range nodes {
+		if len(path) == 1 {
+			missing = append(missing, []byte(path))
+			break
+		}
+	}
+	for path := range nodes {
+		if len(missing) == 1 && len(path) == 3 && !bytes.HasPrefix([]byte(path), missing[0]) {
+			missing = append(missing, []byte(path))
+		}
+	}
+	if len(missing) != 2 {
+		t.Fatal("no nodes to remove")
+	}
+	isMissing := func(path []byte) bool {
+		return bytes.HasPrefix(path, missing[0]) || bytes.HasPrefix(path, missing[1])
+	}
+	var want []string
+	it := tr.NodeIterator(nil)
+	for it.Next(true) {
+		if !isMissing(it.Path()) {
+			want = append(want, fmt.Sprintf("%x:%x:%v", it.Path(), it.Hash(), it.Leaf()))
+		}
+	}
+	tr.reader.banned = map[string]struct{}{string(missing[0]): {}, string(missing[1]): {}}
+
+	have, gaps := walkNodes(t, tr, WalkConfig{Workers: 4})
+	if len(gaps) != 2 {
+		t.Fatalf("wrong number of gaps: have %d, want 2", len(gaps))
+	}
+	for _, gap := range gaps {
+		if !bytes.Equal(gap.Path, missing[0]) && !bytes.Equal(gap.Path, missing[1]) {
+			t.Fatalf("unexpected gap at %x", gap.Path)
+		}
+	}
+	if len(have) != len(want) {
+		t.Fatalf("wrong number of nodes: have %d, want %d", len(have), len(want))
+	}
+	for i := range want {
+		if have[i] != want[i] {
+			t.Fatalf("node %d mismatch: have %s, want %s", i, have[i], want[i])
+		}
+	}
+}
+
+func TestWalkUncommitted(t *testing.T) {
+	_, trie, _ := makeTestTrie(t)
+	tr := &trie.trie
+	tr.Update(bytes.Repeat([]byte{0xff}, 32), []byte{1})
+
+	_, err := Walk(context.Background(), tr, WalkConfig{}, func(*WalkNode) error { return nil })
+	if err != ErrDirtyWalk {
+		t.Fatalf("expected error walking uncommitted trie, have %v", err)
+	}
+}
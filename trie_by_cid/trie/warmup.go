@@ -0,0 +1,220 @@
+package trie
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	log "github.com/sirupsen/logrus"
+)
+
+// warmupLogInterval is the interval at which warmup progress is reported
+var warmupLogInterval = 8 * time.Second
+
+// WarmupConfig configures a warmup of the clean node cache
+type WarmupConfig struct {
+	// Roots are the state roots whose account tries are loaded
+	Roots []common.Hash
+	// Contracts are the accounts whose storage tries are loaded, under each state root
+	Contracts []common.Address
+	// Depth is the depth budget, in nibbles below the root, of the nodes loaded from the
+	// account tries. StorageDepth is the same for storage tries; if zero, Depth is used.
+	Depth        int
+	StorageDepth int
+	// Workers is the number of concurrent loaders, or GOMAXPROCS if zero
+	Workers int
+	// Progress, if set, is called periodically during the warmup and once it's done
+	Progress func(WarmupStats)
+}
+
+// WarmupStats reports the progress of a warmup
+type WarmupStats struct {
+	Nodes   uint64 // number of nodes visited
+	Tries   uint64 // number of walks completed, over storage tries and account subtries
+	Elapsed time.Duration
+}
+
+// warmupJob is a walk over a trie, or a subtree of it, down to a depth budget
+type warmupJob struct {
+	reader *trieReader
+	path   []byte // path of the subtree root, in nibbles
+	hash   common.Hash
+	depth  int
+}
+
+// Warmup populates the clean cache by loading the top levels of the given account and
+// storage tries. Account tries are split into the subtries below their root to spread the
+// work over the workers. Nodes already cached are not reloaded, so it's cheap to run over
+// overlapping states.
+func (db *Database) Warmup(ctx context.Context, config WarmupConfig) (WarmupStats, error) {
+	if db.cleans == nil {
+		return WarmupStats{}, errors.New("clean cache is disabled")
+	}
+	workers := config.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	storageDepth := config.StorageDepth
+	if storageDepth == 0 {
+		storageDepth = config.Depth
+	}
+	var (
+		start   = time.Now()
+		nodes   atomic.Uint64
+		tries   atomic.Uint64
+		jobs    = make(chan warmupJob)
+		errOnce sync.Once
+		err     error
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stats := func() WarmupStats {
+		return WarmupStats{Nodes: nodes.Load(), Tries: tries.Load(), Elapsed: time.Since(start)}
+	}
+	report := func(s WarmupStats, done bool) {
+		msg := "Warming up clean trie cache"
+		if done {
+			msg = "Warmed up clean trie cache"
+		}
+		log.Info(msg, "nodes", s.Nodes, "tries", s.Tries, "elapsed", common.PrettyDuration(s.Elapsed))
+		if config.Progress != nil {
+			config.Progress(s)
+		}
+	}
+
+	fail := func(ferr error) {
+		errOnce.Do(func() {
+			err = ferr
+			cancel()
+		})
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if jerr := warmup(ctx, job, &nodes); jerr != nil {
+					fail(jerr)
+					continue
+				}
+				tries.Add(1)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		send := func(job warmupJob) bool {
+			select {
+			case jobs <- job:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for _, root := range config.Roots {
+			// the account trie is opened once, to split it and to resolve the storage roots
+			st, err := NewStateTrie(StateTrieID(root), db, StateTrieCodec)
+			if err != nil {
+				fail(err)
+				return
+			}
+			if st.trie.root != nil {
+				nodes.Add(1)
+			}
+			for _, job := range warmupSubtries(&st.trie, config.Depth) {
+				if !send(job) {
+					return
+				}
+			}
+			for _, contract := range config.Contracts {
+				acct, err := st.TryGetAccount(contract)
+				if err != nil {
+					fail(err)
+					return
+				}
+				if acct == nil || acct.Root == types.EmptyRootHash {
+					continue
+				}
+				reader, err := newTrieReader(root, crypto.Keccak256Hash(contract.Bytes()), db, StorageTrieCodec)
+				if err != nil {
+					fail(err)
+					return
+				}
+				if !send(warmupJob{reader: reader, hash: acct.Root, depth: storageDepth}) {
+					return
+				}
+			}
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	ticker := time.NewTicker(warmupLogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			report(stats(), false)
+		case <-done:
+			if err == nil {
+				err = ctx.Err()
+			}
+			if err != nil {
+				return stats(), err
+			}
+			s := stats()
+			report(s, true)
+			return s, nil
+		}
+	}
+}
+
+// warmupSubtries returns the jobs walking the stored subtries below the root of a trie
+func warmupSubtries(tr *Trie, depth int) []warmupJob {
+	var jobs []warmupJob
+	add := func(path []byte, child node) {
+		if hash, ok := child.(hashNode); ok && len(path) <= depth {
+			jobs = append(jobs, warmupJob{reader: tr.reader, path: path, hash: common.BytesToHash(hash), depth: depth})
+		}
+	}
+	switch n := tr.root.(type) {
+	case *fullNode:
+		for i, child := range n.Children[:16] {
+			add([]byte{byte(i)}, child)
+		}
+	case *shortNode:
+		add(common.CopyBytes(n.Key), n.Val)
+	}
+	return jobs
+}
+
+// warmup walks the subtrie of a single job down to its depth budget
+func warmup(ctx context.Context, job warmupJob, nodes *atomic.Uint64) error {
+	w := &walker{ctx: ctx, reader: job.reader}
+	count := func(n *WalkNode) error {
+		if n.Hash != (common.Hash{}) {
+			nodes.Add(1)
+		}
+		return nil
+	}
+	// nodes below the depth budget are not loaded
+	skip := func([]byte, hashNode) error { return nil }
+	if err := w.walk(hashNode(job.hash.Bytes()), job.path, job.depth+1, count, skip); err != nil {
+		return err
+	}
+	if len(w.gaps) > 0 {
+		return w.gaps[0]
+	}
+	return nil
+}
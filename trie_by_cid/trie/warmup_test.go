@@ -0,0 +1,64 @@
+package trie
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethstate "github.com/ethereum/go-ethereum/core/state"
+
+	"github.com/cerc-io/ipld-eth-statedb/internal"
+)
+
+func TestWarmup(t *testing.T) {
+	contract := common.HexToAddress("0x1000000000000000000000000000000000000002")
+	edb, root := internal.MakeCidState(t, func(sdb *gethstate.StateDB) {
+		for i := int64(0); i < 1000; i++ {
+			sdb.SetBalance(common.BigToAddress(big.NewInt(i+1000)), big.NewInt(i+1))
+			sdb.SetState(contract, common.BigToHash(big.NewInt(i)), common.BigToHash(big.NewInt(i+1)))
+		}
+	})
+
+	db := NewDatabaseWithConfig(edb, &trieConfig)
+	if _, err := NewDatabase(edb).Warmup(context.Background(), WarmupConfig{Roots: []common.Hash{root}}); err == nil {
+		t.Fatal("expected warmup to fail without a clean cache")
+	}
+
+	// with no depth budget, only the root is loaded
+	stats, err := db.Warmup(context.Background(), WarmupConfig{Roots: []common.Hash{root}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Nodes != 1 || stats.Tries != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if !db.cleans.Has(root.Bytes()) {
+		t.Fatal("root not cached")
+	}
+
+	// the root and a full level of branches
+	var progress []WarmupStats
+	stats, err = db.Warmup(context.Background(), WarmupConfig{
+		Roots:     []common.Hash{root},
+		Contracts: []common.Address{contract},
+		Depth:     1,
+		Workers:   4,
+		Progress:  func(s WarmupStats) { progress = append(progress, s) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Nodes != 2*(1+16) || stats.Tries != 17 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != stats {
+		t.Fatalf("final progress not reported: %+v", progress)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := db.Warmup(ctx, WarmupConfig{Roots: []common.Hash{root}, Depth: 64}); err == nil {
+		t.Fatal("expected cancelled warmup to fail")
+	}
+}
@@ -0,0 +1,68 @@
+package validator
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cerc-io/ipld-eth-statedb/sql"
+)
+
+var _ core.ChainContext = &chainContext{}
+
+// chainContext serves headers out of the indexed data, for the BLOCKHASH opcode and for
+// resolving block authors.
+type chainContext struct {
+	ctx       context.Context
+	db        sql.Database
+	headerSQL string
+	engine    consensus.Engine
+}
+
+func newChainContext(ctx context.Context, db sql.Database, headerSQL string, config *params.ChainConfig) *chainContext {
+	var engine consensus.Engine
+	if config.Clique != nil {
+		// only used to recover block signers, which doesn't touch the database
+		engine = clique.New(config.Clique, rawdb.NewMemoryDatabase())
+	} else {
+		// the faker attributes blocks to the coinbase, as ethash and the beacon chain do
+		engine = ethash.NewFaker()
+	}
+	return &chainContext{ctx: ctx, db: db, headerSQL: headerSQL, engine: engine}
+}
+
+// Engine satisfies core.ChainContext
+func (cc *chainContext) Engine() consensus.Engine {
+	return cc.engine
+}
+
+// GetHeader satisfies core.ChainContext
+func (cc *chainContext) GetHeader(hash common.Hash, _ uint64) *types.Header {
+	header, err := cc.header(hash)
+	if err != nil {
+		log.Error("failed to load indexed header", "hash", hash, "err", err)
+		return nil
+	}
+	return header
+}
+
+func (cc *chainContext) header(hash common.Hash) (*types.Header, error) {
+	var data []byte
+	if err := cc.db.QueryRow(cc.ctx, cc.headerSQL, hash.Hex()).Scan(&data); err != nil {
+		return nil, err
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(data, header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
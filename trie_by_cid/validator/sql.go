@@ -0,0 +1,60 @@
+package validator
+
+import (
+	leaf "github.com/cerc-io/ipld-eth-statedb/direct_by_leaf"
+)
+
+const (
+	headerTemplate = `SELECT data FROM {eth}.header_cids
+						INNER JOIN {ipld}.blocks ON (
+							header_cids.cid = blocks.key
+							AND header_cids.block_number = blocks.block_number
+						)
+						WHERE header_cids.block_hash = $1`
+	unclesTemplate = `SELECT data FROM {eth}.uncle_cids
+						INNER JOIN {ipld}.blocks ON (
+							uncle_cids.cid = blocks.key
+							AND uncle_cids.block_number = blocks.block_number
+						)
+						WHERE uncle_cids.header_id = $1
+						LIMIT 1`
+	transactionCountTemplate = `SELECT COUNT(*) FROM {eth}.transaction_cids WHERE header_id = $1`
+	transactionTemplate      = `SELECT data FROM {eth}.transaction_cids
+						INNER JOIN {ipld}.blocks ON (
+							transaction_cids.cid = blocks.key
+							AND transaction_cids.block_number = blocks.block_number
+						)
+						WHERE transaction_cids.header_id = $1
+						AND transaction_cids.index = $2`
+	receiptTemplate = `SELECT data FROM {eth}.receipt_cids
+						INNER JOIN {eth}.transaction_cids ON (
+							receipt_cids.tx_id = transaction_cids.tx_hash
+							AND receipt_cids.header_id = transaction_cids.header_id
+							AND receipt_cids.block_number = transaction_cids.block_number
+						)
+						INNER JOIN {ipld}.blocks ON (
+							receipt_cids.cid = blocks.key
+							AND receipt_cids.block_number = blocks.block_number
+						)
+						WHERE receipt_cids.header_id = $1
+						AND transaction_cids.index = $2`
+)
+
+// statements are the statements reading block data, in the configured schemas
+type statements struct {
+	Header           string
+	Uncles           string
+	TransactionCount string
+	Transaction      string
+	Receipt          string
+}
+
+func newStatements(config leaf.StatementConfig) statements {
+	return statements{
+		Header:           config.Expand(headerTemplate),
+		Uncles:           config.Expand(unclesTemplate),
+		TransactionCount: config.Expand(transactionCountTemplate),
+		Transaction:      config.Expand(transactionTemplate),
+		Receipt:          config.Expand(receiptTemplate),
+	}
+}
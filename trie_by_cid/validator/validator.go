@@ -0,0 +1,334 @@
+// Package validator re-executes indexed blocks on top of the trie_by_cid StateDB, in order to
+// audit indexed data end-to-end: the state root resulting from the replay is checked against
+// the root in the indexed header.
+package validator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	leaf "github.com/cerc-io/ipld-eth-statedb/direct_by_leaf"
+	"github.com/cerc-io/ipld-eth-statedb/sql"
+	"github.com/cerc-io/ipld-eth-statedb/trie_by_cid/state"
+)
+
+var (
+	big8  = big.NewInt(8)
+	big32 = big.NewInt(32)
+
+	// ErrWithdrawalsUnsupported is returned when validating a block with withdrawals, which
+	// are not indexed by the supported ipld-eth-db schema, so their balance changes can't be
+	// replayed
+	ErrWithdrawalsUnsupported = errors.New("blocks with withdrawals are not supported")
+)
+
+// Validator replays indexed blocks and validates the resulting state
+type Validator struct {
+	db          sql.Database
+	stateCache  state.Database
+	chainConfig *params.ChainConfig
+	config      Config
+	stmts       statements
+}
+
+// Config configures how a Validator reads the indexed data
+type Config struct {
+	// Hybrid reads the parent state from the leaf tables, and only loads the trie nodes needed
+	// to compute the resulting root from the state cache. See state.NewHybrid.
+	Hybrid bool
+	// Statements configures the schemas of the indexed tables, for both block data and leaves
+	Statements leaf.StatementConfig
+}
+
+// NewValidator returns a Validator reading block data from db, and state from stateCache
+func NewValidator(db sql.Database, stateCache state.Database, chainConfig *params.ChainConfig) *Validator {
+	return NewValidatorWithConfig(db, stateCache, chainConfig, Config{})
+}
+
+// NewHybridValidator returns a Validator which reads the parent state from the leaf tables
+// in db, and only loads the trie nodes needed to compute the resulting root from stateCache.
+// See state.NewHybrid.
+func NewHybridValidator(db sql.Database, stateCache state.Database, chainConfig *params.ChainConfig) *Validator {
+	return NewValidatorWithConfig(db, stateCache, chainConfig, Config{Hybrid: true})
+}
+
+// NewValidatorWithConfig returns a Validator reading the indexed data as configured
+func NewValidatorWithConfig(db sql.Database, stateCache state.Database, chainConfig *params.ChainConfig, config Config) *Validator {
+	return &Validator{
+		db:          db,
+		stateCache:  stateCache,
+		chainConfig: chainConfig,
+		config:      config,
+		stmts:       newStatements(config.Statements),
+	}
+}
+
+// Report describes the outcome of replaying a block
+type Report struct {
+	BlockHash    common.Hash
+	BlockNumber  uint64
+	ExpectedRoot common.Hash // state root of the indexed header
+	ComputedRoot common.Hash // state root resulting from the replay
+
+	// FirstDivergentTx is the index of the first transaction whose execution doesn't match
+	// its indexed receipt, or -1 if all receipts match. TxDivergence describes the mismatch.
+	FirstDivergentTx int
+	TxDivergence     string
+
+	// DivergentAccounts lists the accounts modified by the replay whose resulting state
+	// differs from the indexed post-state.
+	DivergentAccounts []AccountDivergence
+}
+
+// Valid reports whether the replay produced the expected state root
+func (r *Report) Valid() bool {
+	return r.ExpectedRoot == r.ComputedRoot
+}
+
+// AccountDivergence holds the expected and computed state of a divergent account. Either
+// is nil if the account doesn't exist in that state.
+type AccountDivergence struct {
+	Address  common.Address
+	Expected *types.StateAccount
+	Computed *types.StateAccount
+}
+
+// ValidateBlock replays the indexed block with the given hash on top of its parent's state,
+// and reports whether the resulting state root matches the one in the block header.
+//
+// Block rewards are applied for proof-of-work blocks. Irregular state changes, such as the
+// DAO hard fork, are not supported. Neither are withdrawals, which are not indexed by the
+// supported ipld-eth-db schema: ErrWithdrawalsUnsupported is returned for any block whose
+// withdrawals list isn't empty, which excludes most post-Shanghai blocks.
+func (v *Validator) ValidateBlock(ctx context.Context, blockHash common.Hash) (*Report, error) {
+	chain := newChainContext(ctx, v.db, v.stmts.Header, v.chainConfig)
+	header, err := chain.header(blockHash)
+	if err != nil {
+		return nil, fmt.Errorf("error loading header %s: %w", blockHash, err)
+	}
+	if header.WithdrawalsHash != nil && *header.WithdrawalsHash != types.EmptyRootHash {
+		return nil, ErrWithdrawalsUnsupported
+	}
+	parent, err := chain.header(header.ParentHash)
+	if err != nil {
+		return nil, fmt.Errorf("error loading parent header %s: %w", header.ParentHash, err)
+	}
+	var statedb *state.StateDB
+	if v.config.Hybrid {
+		statedb, err = state.NewHybridWithConfig(ctx, v.db, v.stateCache, parent, v.config.Statements)
+	} else {
+		statedb, err = state.New(parent.Root, v.stateCache, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	statedb.StartPrefetcher("validator")
+	defer statedb.StopPrefetcher()
+
+	report := &Report{
+		BlockHash:        blockHash,
+		BlockNumber:      header.Number.Uint64(),
+		ExpectedRoot:     header.Root,
+		FirstDivergentTx: -1,
+	}
+
+	var txCount int
+	if err := v.db.QueryRow(ctx, v.stmts.TransactionCount, blockHash.Hex()).Scan(&txCount); err != nil {
+		return nil, err
+	}
+	var (
+		gp      = new(core.GasPool).AddGas(header.GasLimit)
+		usedGas uint64
+		signer  = types.MakeSigner(v.chainConfig, header.Number)
+		eip158  = v.chainConfig.IsEIP158(header.Number)
+		vmenv   = vm.NewEVM(core.NewEVMBlockContext(header, chain, nil), vm.TxContext{}, statedb, v.chainConfig, vm.Config{})
+	)
+	for i := 0; i < txCount; i++ {
+		tx, expected, err := v.transaction(ctx, blockHash, i)
+		if err != nil {
+			return nil, err
+		}
+		msg, err := core.TransactionToMessage(tx, signer, header.BaseFee)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert tx %d [%v] to message: %w", i, tx.Hash(), err)
+		}
+		statedb.SetTxContext(tx.Hash(), i)
+		vmenv.Reset(core.NewEVMTxContext(msg), statedb)
+
+		result, err := core.ApplyMessage(vmenv, msg, gp)
+		if err != nil {
+			// the transaction is invalid on top of the replayed state, so nothing after it can be trusted
+			if report.FirstDivergentTx < 0 {
+				report.FirstDivergentTx = i
+				report.TxDivergence = fmt.Sprintf("could not apply tx [%v]: %v", tx.Hash(), err)
+			}
+			break
+		}
+		var root []byte
+		if v.chainConfig.IsByzantium(header.Number) {
+			statedb.Finalise(true)
+		} else {
+			root = statedb.IntermediateRoot(eip158).Bytes()
+		}
+		if err := statedb.Error(); err != nil {
+			return nil, err
+		}
+		usedGas += result.UsedGas
+
+		if report.FirstDivergentTx < 0 {
+			if reason := compareReceipt(expected, root, result, usedGas); reason != "" {
+				report.FirstDivergentTx = i
+				report.TxDivergence = fmt.Sprintf("tx [%v]: %s", tx.Hash(), reason)
+			}
+		}
+	}
+	if v.chainConfig.Ethash != nil && header.Difficulty.Sign() > 0 {
+		uncles, err := v.uncles(ctx, header)
+		if err != nil {
+			return nil, err
+		}
+		accumulateRewards(v.chainConfig, statedb, header, uncles)
+	}
+	report.ComputedRoot = statedb.IntermediateRoot(eip158)
+	if err := statedb.Error(); err != nil {
+		return nil, err
+	}
+	if !report.Valid() {
+		if report.DivergentAccounts, err = v.divergentAccounts(header.Root, statedb); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// transaction loads the transaction at the given index and its receipt
+func (v *Validator) transaction(ctx context.Context, blockHash common.Hash, index int) (*types.Transaction, *types.Receipt, error) {
+	var txData, rctData []byte
+	if err := v.db.QueryRow(ctx, v.stmts.Transaction, blockHash.Hex(), index).Scan(&txData); err != nil {
+		return nil, nil, fmt.Errorf("error loading tx %d: %w", index, err)
+	}
+	if err := v.db.QueryRow(ctx, v.stmts.Receipt, blockHash.Hex(), index).Scan(&rctData); err != nil {
+		return nil, nil, fmt.Errorf("error loading receipt %d: %w", index, err)
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(txData); err != nil {
+		return nil, nil, err
+	}
+	rct := new(types.Receipt)
+	if err := rct.UnmarshalBinary(rctData); err != nil {
+		return nil, nil, err
+	}
+	return tx, rct, nil
+}
+
+// uncles loads the uncles of the block, which are indexed as a single list
+func (v *Validator) uncles(ctx context.Context, header *types.Header) ([]*types.Header, error) {
+	if header.UncleHash == types.EmptyUncleHash {
+		return nil, nil
+	}
+	var data []byte
+	if err := v.db.QueryRow(ctx, v.stmts.Uncles, header.Hash().Hex()).Scan(&data); err != nil {
+		return nil, fmt.Errorf("error loading uncles: %w", err)
+	}
+	var uncles []*types.Header
+	if err := rlp.DecodeBytes(data, &uncles); err != nil {
+		return nil, err
+	}
+	return uncles, nil
+}
+
+// divergentAccounts compares the accounts modified by the replay against the expected state
+func (v *Validator) divergentAccounts(expectedRoot common.Hash, statedb *state.StateDB) ([]AccountDivergence, error) {
+	tr, err := v.stateCache.OpenTrie(expectedRoot)
+	if err != nil {
+		return nil, err
+	}
+	var diverged []AccountDivergence
+	for _, addr := range statedb.DirtyAccounts() {
+		expected, err := tr.TryGetAccount(addr)
+		if err != nil {
+			return nil, err
+		}
+		var computed *types.StateAccount
+		if statedb.Exist(addr) {
+			computed = &types.StateAccount{
+				Nonce:    statedb.GetNonce(addr),
+				Balance:  statedb.GetBalance(addr),
+				Root:     statedb.GetStorageRoot(addr),
+				CodeHash: statedb.GetCodeHash(addr).Bytes(),
+			}
+		}
+		if !accountsEqual(expected, computed) {
+			diverged = append(diverged, AccountDivergence{Address: addr, Expected: expected, Computed: computed})
+		}
+	}
+	return diverged, nil
+}
+
+// compareReceipt checks an execution result against the indexed receipt, returning a
+// description of any mismatch
+func compareReceipt(expected *types.Receipt, root []byte, result *core.ExecutionResult, cumulativeGas uint64) string {
+	if len(root) > 0 {
+		if !bytes.Equal(root, expected.PostState) {
+			return fmt.Sprintf("post-state root mismatch: expected %x, computed %x", expected.PostState, root)
+		}
+	} else {
+		status := types.ReceiptStatusSuccessful
+		if result.Failed() {
+			status = types.ReceiptStatusFailed
+		}
+		if status != expected.Status {
+			return fmt.Sprintf("status mismatch: expected %d, computed %d (%v)", expected.Status, status, result.Err)
+		}
+	}
+	if cumulativeGas != expected.CumulativeGasUsed {
+		return fmt.Sprintf("cumulative gas mismatch: expected %d, computed %d", expected.CumulativeGasUsed, cumulativeGas)
+	}
+	return ""
+}
+
+func accountsEqual(a, b *types.StateAccount) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Nonce == b.Nonce &&
+		a.Balance.Cmp(b.Balance) == 0 &&
+		a.Root == b.Root &&
+		bytes.Equal(a.CodeHash, b.CodeHash)
+}
+
+// accumulateRewards credits the coinbase of the given block with the mining reward, plus
+// the rewards for included uncles (copied from go-ethereum/consensus/ethash).
+func accumulateRewards(config *params.ChainConfig, statedb *state.StateDB, header *types.Header, uncles []*types.Header) {
+	blockReward := ethash.FrontierBlockReward
+	if config.IsByzantium(header.Number) {
+		blockReward = ethash.ByzantiumBlockReward
+	}
+	if config.IsConstantinople(header.Number) {
+		blockReward = ethash.ConstantinopleBlockReward
+	}
+	reward := new(big.Int).Set(blockReward)
+	r := new(big.Int)
+	for _, uncle := range uncles {
+		r.Add(uncle.Number, big8)
+		r.Sub(r, header.Number)
+		r.Mul(r, blockReward)
+		r.Div(r, big8)
+		statedb.AddBalance(uncle.Coinbase, r)
+
+		r.Div(blockReward, big32)
+		reward.Add(reward, r)
+	}
+	statedb.AddBalance(header.Coinbase, reward)
+}
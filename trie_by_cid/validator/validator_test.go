@@ -0,0 +1,251 @@
+package validator_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	pgipfsethdb "github.com/cerc-io/ipfs-ethdb/v5/postgres/v0"
+	"github.com/cerc-io/plugeth-statediff/indexer/database/sql/postgres"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	gethstate "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/jackc/pgx/v4"
+
+	leaf "github.com/cerc-io/ipld-eth-statedb/direct_by_leaf"
+	"github.com/cerc-io/ipld-eth-statedb/internal"
+	"github.com/cerc-io/ipld-eth-statedb/sql"
+	"github.com/cerc-io/ipld-eth-statedb/trie_by_cid/helper"
+	"github.com/cerc-io/ipld-eth-statedb/trie_by_cid/state"
+	"github.com/cerc-io/ipld-eth-statedb/trie_by_cid/validator"
+)
+
+var (
+	testCtx       = context.Background()
+	testConfig, _ = postgres.TestConfig.WithEnv()
+
+	testKey, _    = crypto.GenerateKey()
+	testSender    = crypto.PubkeyToAddress(testKey.PublicKey)
+	testRecipient = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	testSigner    = types.LatestSigner(helper.ChainConfig)
+
+	teardownStatements = []string{
+		`TRUNCATE eth.header_cids`,
+		`TRUNCATE eth.uncle_cids`,
+		`TRUNCATE eth.transaction_cids`,
+		`TRUNCATE eth.receipt_cids`,
+		`TRUNCATE eth.log_cids`,
+		`TRUNCATE eth.state_cids`,
+		`TRUNCATE eth.storage_cids`,
+		`TRUNCATE ipld.blocks`,
+	}
+)
+
+// testChain is a genesis block funding the sender, and a child block transferring value from it
+type testChain struct {
+	stateCache gethstate.Database
+	genesis    *types.Block
+	block      *types.Block
+	receipts   types.Receipts
+}
+
+func newTestChain(t *testing.T) *testChain {
+	genesis := &core.Genesis{
+		Config:  helper.ChainConfig,
+		Alloc:   core.GenesisAlloc{testSender: {Balance: big.NewInt(params.Ether)}},
+		BaseFee: big.NewInt(params.InitialBaseFee),
+	}
+	db, blocks, receipts := core.GenerateChainWithGenesis(genesis, ethash.NewFaker(), 1, func(i int, gen *core.BlockGen) {
+		gen.AddTx(transferTx(t, 0, big.NewInt(1000), gen.BaseFee()))
+	})
+	return &testChain{
+		stateCache: gethstate.NewDatabase(db),
+		genesis:    rawdb.ReadBlock(db, blocks[0].ParentHash(), 0),
+		block:      blocks[0],
+		receipts:   receipts[0],
+	}
+}
+
+func transferTx(t *testing.T, nonce uint64, value, gasPrice *big.Int) *types.Transaction {
+	tx, err := types.SignNewTx(testKey, testSigner, &types.LegacyTx{
+		Nonce:    nonce,
+		To:       &testRecipient,
+		Value:    value,
+		Gas:      params.TxGas,
+		GasPrice: gasPrice,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+// index indexes the genesis block, and the given block in place of the child block. It
+// returns a validator reading from the indexed data.
+func (c *testChain) index(t *testing.T, block *types.Block, receipts types.Receipts, hybrid bool) *validator.Validator {
+	pool, err := postgres.ConnectSQLX(testCtx, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, stmt := range teardownStatements {
+			if _, err := pool.Exec(stmt); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	if err := helper.IndexBlock(testConfig, c.stateCache, types.EmptyRootHash, c.genesis, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := helper.IndexBlock(testConfig, c.stateCache, c.genesis.Root(), block, receipts); err != nil {
+		t.Fatal(err)
+	}
+
+	db := sql.NewSQLXDriverFromPool(testCtx, pool)
+	stateCache := state.NewDatabase(pgipfsethdb.NewDatabase(pool, internal.MakeCacheConfig(t)))
+	if hybrid {
+		return validator.NewHybridValidator(db, stateCache, helper.ChainConfig)
+	}
+	return validator.NewValidator(db, stateCache, helper.ChainConfig)
+}
+
+func TestValidateBlock(t *testing.T) {
+	chain := newTestChain(t)
+
+	validate := func(t *testing.T, v *validator.Validator) *validator.Report {
+		report, err := v.ValidateBlock(testCtx, chain.block.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	for _, hybrid := range []bool{false, true} {
+		hybrid := hybrid
+		t.Run(fmt.Sprintf("valid (hybrid: %v)", hybrid), func(t *testing.T) {
+			report := validate(t, chain.index(t, chain.block, chain.receipts, hybrid))
+			if !report.Valid() {
+				t.Fatalf("expected valid block, computed root %x, divergent accounts %+v",
+					report.ComputedRoot, report.DivergentAccounts)
+			}
+			if report.FirstDivergentTx != -1 {
+				t.Fatalf("unexpected tx divergence: %s", report.TxDivergence)
+			}
+		})
+	}
+
+	t.Run("account divergence", func(t *testing.T) {
+		// replace the transfer with one of a different value, and the same receipt
+		tx := transferTx(t, 0, big.NewInt(2000), chain.block.Transactions()[0].GasPrice())
+		rct := *chain.receipts[0]
+		rct.TxHash = tx.Hash()
+		block := types.NewBlockWithHeader(chain.block.Header()).WithBody(types.Transactions{tx}, nil)
+
+		report := validate(t, chain.index(t, block, types.Receipts{&rct}, false))
+		if report.Valid() {
+			t.Fatal("expected invalid block")
+		}
+		if report.FirstDivergentTx != -1 {
+			t.Fatalf("unexpected tx divergence: %s", report.TxDivergence)
+		}
+		divergent := make(map[common.Address]validator.AccountDivergence)
+		for _, div := range report.DivergentAccounts {
+			divergent[div.Address] = div
+		}
+		if len(divergent) != 2 {
+			t.Fatalf("expected sender and recipient to diverge, have %+v", report.DivergentAccounts)
+		}
+		if _, ok := divergent[testSender]; !ok {
+			t.Fatal("expected sender to diverge")
+		}
+		div, ok := divergent[testRecipient]
+		if !ok || div.Expected == nil || div.Computed == nil {
+			t.Fatalf("expected recipient to diverge, have %+v", div)
+		}
+		if div.Expected.Balance.Cmp(big.NewInt(1000)) != 0 || div.Computed.Balance.Cmp(big.NewInt(2000)) != 0 {
+			t.Fatalf("wrong recipient balances: expected %v, computed %v", div.Expected.Balance, div.Computed.Balance)
+		}
+	})
+
+	t.Run("receipt divergence", func(t *testing.T) {
+		rct := *chain.receipts[0]
+		rct.Status = types.ReceiptStatusFailed
+
+		report := validate(t, chain.index(t, chain.block, types.Receipts{&rct}, false))
+		if !report.Valid() {
+			t.Fatalf("expected valid state, computed root %x", report.ComputedRoot)
+		}
+		if report.FirstDivergentTx != 0 || report.TxDivergence == "" {
+			t.Fatalf("expected divergence at tx 0, have %d (%s)", report.FirstDivergentTx, report.TxDivergence)
+		}
+	})
+
+	t.Run("withdrawals", func(t *testing.T) {
+		// an empty withdrawals list doesn't change the state
+		header := chain.block.Header()
+		header.WithdrawalsHash = &types.EmptyRootHash
+		block := types.NewBlockWithHeader(header).WithBody(chain.block.Transactions(), nil)
+
+		v := chain.index(t, block, chain.receipts, false)
+		report, err := v.ValidateBlock(testCtx, block.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.Valid() {
+			t.Fatalf("expected valid block, computed root %x", report.ComputedRoot)
+		}
+	})
+
+	t.Run("unsupported withdrawals", func(t *testing.T) {
+		header := chain.block.Header()
+		header.WithdrawalsHash = &common.Hash{0x01}
+		block := types.NewBlockWithHeader(header).WithBody(chain.block.Transactions(), nil)
+
+		v := chain.index(t, block, chain.receipts, false)
+		if _, err := v.ValidateBlock(testCtx, block.Hash()); !errors.Is(err, validator.ErrWithdrawalsUnsupported) {
+			t.Fatalf("expected unsupported withdrawals, got %v", err)
+		}
+	})
+}
+
+// queryRecorder is a sql.Driver recording the statements it's asked to run, which all return
+// no rows
+type queryRecorder struct {
+	queries []string
+}
+
+func (d *queryRecorder) QueryRow(ctx context.Context, sql string, args ...interface{}) sql.ScannableRow {
+	d.queries = append(d.queries, sql)
+	return noRows{}
+}
+
+func (d *queryRecorder) Exec(ctx context.Context, sql string, args ...interface{}) (sql.Result, error) {
+	panic("unexpected Exec")
+}
+
+type noRows struct{}
+
+func (noRows) Scan(...interface{}) error { return pgx.ErrNoRows }
+
+func TestValidatorConfig(t *testing.T) {
+	db := &queryRecorder{}
+	v := validator.NewValidatorWithConfig(db, nil, helper.ChainConfig, validator.Config{
+		Statements: leaf.StatementConfig{EthSchema: "chain2_eth", IPLDSchema: "chain2_ipld"},
+	})
+	if _, err := v.ValidateBlock(testCtx, common.Hash{}); !sql.IsNoRows(err) {
+		t.Fatalf("expected missing header, got %v", err)
+	}
+	if len(db.queries) != 1 ||
+		!strings.Contains(db.queries[0], "FROM chain2_eth.header_cids") ||
+		!strings.Contains(db.queries[0], "JOIN chain2_ipld.blocks") {
+		t.Fatalf("header not read from the configured schemas: %v", db.queries)
+	}
+}